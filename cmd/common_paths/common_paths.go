@@ -1,15 +1,23 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"dev.acorello.it/go/arkivist/sets"
 )
 
+var inodesFlag = flag.Bool("inodes", false, "tell common paths that are the very same file (hard links) from copies and different files, list the files reachable through several paths and the disk usage they save")
+
+var setUpWalking = walkFlags(flag.CommandLine)
+
+var compareFlag = flag.String("compare", comparePath, "what makes files common: path, size (same path and size), hash (same bytes at any path) or path+hash (same path, telling identical from differing, and moved bytes)")
+
 // Given two or more unique directories as arguments
 // Output the file paths they have in common; empty directories are ignored.
 //
@@ -27,55 +35,112 @@ import (
 // Outputs `A/a.txt`
 //
 // Input directories are converted to absolute paths and normalized before being compared.
+// Files matching -exclude patterns, or those of the ignore files found along the walk, are left out;
+// so are .DS_Store, Thumbs.db, desktop.ini and .git directories.
+//
+// The output is the intersection of the set of subpaths of each directory, in the order they are walked:
+// the directories are walked all at once and each path is printed as soon as it's found in all of them.
+// With -compare other than path, each line starts with the status of the files: identical, differing or moved;
+// a moved content is followed by its path in each directory, in the order they were given.
 //
-// The output is the intersection of the set of subpaths of each directory.
+// `common_paths treediff` reports instead, for each path of any directory, which directories hold it.
 func main() {
-	dirs := validatedDirs()
-	uniqueFiles := sets.New[string]()
-	// (->> dirSet (map list-files) (map set) set/intersection)
-	for i, d := range dirs.Entries() {
-		if i == 0 {
-			collectRelFilePaths(d, uniqueFiles.Add)
-			continue
+	if len(os.Args) > 1 && os.Args[1] == "treediff" {
+		treeDiffCommand(os.Args[2:])
+		return
+	}
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: common_paths [-compare MODE | -inodes] [-exclude PATTERN] [-ignore-file NAME] [-follow-symlinks] DIR1 DIR2 [...DIRN]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       common_paths treediff [-format table|json] [-exclude PATTERN] [-ignore-file NAME] [-follow-symlinks] DIR1 DIR2 [...DIRN]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	setUpWalking()
+	if *inodesFlag && isFlagGiven(flag.CommandLine, "compare") {
+		fmt.Fprintln(flag.CommandLine.Output(), "-inodes and -compare are mutually exclusive")
+		flag.Usage()
+		os.Exit(2)
+	}
+	switch *compareFlag {
+	case comparePath, compareSize, compareHash, comparePathHash:
+	default:
+		log.Fatalf("unknown comparison %q", *compareFlag)
+	}
+	dirs := validatedDirs(flag.Args())
+	if *inodesFlag {
+		index, trees, err := indexInodes(dirs)
+		if err != nil {
+			log.Fatal(err)
 		}
-		if uniqueFiles.IsEmpty() {
-			// whenever I end up with an empty set there is no point in continuing
-			break
+		if err := printInodes(os.Stdout, index, trees); err != nil {
+			log.Fatal(err)
 		}
-		currentSet := sets.New[string]()
-		collectRelFilePaths(d, currentSet.Add)
-		// from the the second iteration onwards I have to collect the paths I've already seen and carry over only those ones.
-		uniqueFiles = uniqueFiles.Intersection(currentSet)
+		return
 	}
-	for f := range uniqueFiles {
-		fmt.Println(f)
+	if *compareFlag == comparePath {
+		printCommonPaths(dirs)
+		return
+	}
+	trees := make([]tree, len(dirs))
+	for i, d := range dirs {
+		trees[i] = tree{root: d, sizes: map[string]int64{}}
+		collectRelFilePaths(d, func(relPath string, info fs.DirEntry) {
+			fileInfo, err := info.Info()
+			if err != nil {
+				log.Fatalf("failed to get info for %q: %s", relPath, err.Error())
+			}
+			trees[i].sizes[relPath] = fileInfo.Size()
+		})
+	}
+	comparisons, err := compare(*compareFlag, trees)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range comparisons {
+		fmt.Println(c)
 	}
 }
 
-func collectRelFilePaths(dirCleanPath string, collect func(string)) {
-	// `dirCleanPath` should always be a clean path for the `relPathOrPanic` to work
-	err := filepath.WalkDir(dirCleanPath, func(path string, info fs.DirEntry, stumbled error) error {
-		if stumbled != nil {
-			return stumbled
-		}
-		if info.IsDir() {
-			return nil
-		}
-		relPath, err := filepath.Rel(dirCleanPath, path)
-		if err != nil {
-			log.Panicf("failed to relativize path %q based on %q: %s", path, dirCleanPath, err.Error())
-		}
-		collect(relPath)
+// isFlagGiven tells whether the flag called name was set on the command line.
+func isFlagGiven(flags *flag.FlagSet, name string) (given bool) {
+	flags.Visit(func(f *flag.Flag) {
+		given = given || f.Name == name
+	})
+	return
+}
+
+// printCommonPaths streams the paths in common as the directories are walked, showing the progress on a terminal.
+func printCommonPaths(dirs []string) {
+	progress := newProgress(os.Stderr, len(dirs))
+	if stderrIsTerminal() {
+		progress.start(200 * time.Millisecond)
+		defer progress.finish()
+	}
+	intersect(dirs, progress.walked, func(relPath string) {
+		progress.common.Add(1)
+		progress.println(os.Stdout, relPath)
+	})
+}
+
+func collectRelFilePaths(dirCleanPath string, collect func(string, fs.DirEntry)) {
+	walkRelFilePaths(dirCleanPath, func(relPath string, info fs.DirEntry) error {
+		collect(relPath, info)
 		return nil
 	})
-	if err != nil {
+}
+
+// walkRelFilePaths visits the files of the directory, but those ignored, until visit returns fs.SkipAll.
+func walkRelFilePaths(dirCleanPath string, visit func(string, fs.DirEntry) error) {
+	if err := walking.walk(dirCleanPath, visit); err != nil {
 		log.Fatalf("error while traversing dir %q: %s", dirCleanPath, err.Error())
 	}
 }
 
-func validatedDirs() sets.Set[string] {
+// validatedDirs returns the directories given as arguments, in order and without duplicates.
+func validatedDirs(args []string) []string {
 	dirs := sets.New[string]()
-	for _, d := range os.Args[1:] {
+	var ordered []string
+	for _, d := range args {
 		a, err := filepath.Abs(d)
 		// absolute path
 		if err != nil {
@@ -88,10 +153,14 @@ func validatedDirs() sets.Set[string] {
 		if !s.IsDir() {
 			log.Fatalf("Not a directory: %s", a)
 		}
-		dirs.Add(a)
+		if !dirs.Contains(a) {
+			dirs.Add(a)
+			ordered = append(ordered, a)
+		}
 	}
 	if len(dirs) < 2 {
 		fmt.Fprintln(os.Stderr, "At least two directories expected")
+		os.Exit(1)
 	}
-	return dirs
+	return ordered
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// comparison modes: by relative path only, by path and size, by content wherever it is, by path and content
+const (
+	comparePath     = "path"
+	compareSize     = "size"
+	compareHash     = "hash"
+	comparePathHash = "path+hash"
+)
+
+// statuses of a comparison
+const (
+	common    = "common"
+	identical = "identical"
+	differing = "differing"
+	moved     = "moved"
+)
+
+// tree is the regular files of a directory, by relative path, with their size.
+type tree struct {
+	root  string
+	sizes map[string]int64
+}
+
+// comparison is the outcome for a relative path, or for a content found at the given path in each tree.
+type comparison struct {
+	status string
+	paths  []string
+}
+
+func (I comparison) String() string {
+	s := I.status
+	for _, p := range I.paths {
+		s += "\t" + p
+	}
+	return s
+}
+
+// hasher hashes each file once.
+type hasher struct {
+	hashes map[string]string
+}
+
+func newHasher() *hasher {
+	return &hasher{hashes: map[string]string{}}
+}
+
+func (I *hasher) hash(filePath string) (string, error) {
+	if h, found := I.hashes[filePath]; found {
+		return h, nil
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %q: %w", filePath, err)
+	}
+	I.hashes[filePath] = hex.EncodeToString(h.Sum(nil))
+	return I.hashes[filePath], nil
+}
+
+// commonPaths are the relative paths found in every tree, sorted.
+func commonPaths(trees []tree) (paths []string) {
+	for relPath := range trees[0].sizes {
+		inAll := true
+		for _, t := range trees[1:] {
+			if _, found := t.sizes[relPath]; !found {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			paths = append(paths, relPath)
+		}
+	}
+	sort.Strings(paths)
+	return
+}
+
+/*
+compare reports, following mode:
+
+  - path: the relative paths common to every tree;
+  - size: the common paths, either identical or differing by size;
+  - hash: the contents found in every tree, identical when at the same path, moved otherwise;
+  - path+hash: the common paths, identical or differing by content, and the contents moved elsewhere.
+
+Files are hashed only when their size is the same in every tree.
+*/
+func compare(mode string, trees []tree) (comparisons []comparison, err error) {
+	hasher := newHasher()
+	matched := make([]map[string]bool, len(trees))
+	for i := range matched {
+		matched[i] = map[string]bool{}
+	}
+	if mode != compareHash {
+		for _, relPath := range commonPaths(trees) {
+			status := common
+			if mode != comparePath {
+				if status, err = comparePathAcross(relPath, trees, mode == comparePathHash, hasher); err != nil {
+					return nil, err
+				}
+			}
+			if status == identical {
+				for i := range matched {
+					matched[i][relPath] = true
+				}
+			}
+			comparisons = append(comparisons, comparison{status: status, paths: []string{relPath}})
+		}
+	}
+	if mode == compareHash || mode == comparePathHash {
+		contents, err := sharedContents(trees, matched, hasher)
+		if err != nil {
+			return nil, err
+		}
+		for _, paths := range contents {
+			status := moved
+			if mode == compareHash && allEqual(paths) {
+				status, paths = identical, paths[:1]
+			}
+			comparisons = append(comparisons, comparison{status: status, paths: paths})
+		}
+	}
+	return
+}
+
+// comparePathAcross tells whether the files at relPath are identical in every tree, by size and, if requested, by content.
+func comparePathAcross(relPath string, trees []tree, byContent bool, hasher *hasher) (string, error) {
+	size := trees[0].sizes[relPath]
+	for _, t := range trees[1:] {
+		if t.sizes[relPath] != size {
+			return differing, nil
+		}
+	}
+	if !byContent {
+		return identical, nil
+	}
+	first, err := hasher.hash(filepath.Join(trees[0].root, relPath))
+	if err != nil {
+		return "", err
+	}
+	for _, t := range trees[1:] {
+		h, err := hasher.hash(filepath.Join(t.root, relPath))
+		if err != nil {
+			return "", err
+		}
+		if h != first {
+			return differing, nil
+		}
+	}
+	return identical, nil
+}
+
+// sharedContents returns, for each content found in every tree outside the matched paths, its first path in each tree; sorted by the path in the first tree.
+func sharedContents(trees []tree, matched []map[string]bool, hasher *hasher) ([][]string, error) {
+	// size pre-filter: only the sizes found in every tree are worth hashing
+	bySize := make([]map[int64][]string, len(trees))
+	for i, t := range trees {
+		bySize[i] = map[int64][]string{}
+		for relPath, size := range t.sizes {
+			if !matched[i][relPath] {
+				bySize[i][size] = append(bySize[i][size], relPath)
+			}
+		}
+	}
+	var shared [][]string
+	for size, candidates := range bySize[0] {
+		inAll := true
+		for _, others := range bySize[1:] {
+			if _, found := others[size]; !found {
+				inAll = false
+				break
+			}
+		}
+		if !inAll {
+			continue
+		}
+		byHash := make([]map[string]string, len(trees))
+		for i := range trees {
+			byHash[i] = map[string]string{}
+			relPaths := candidates
+			if i > 0 {
+				relPaths = bySize[i][size]
+			}
+			sort.Strings(relPaths)
+			for _, relPath := range relPaths {
+				h, err := hasher.hash(filepath.Join(trees[i].root, relPath))
+				if err != nil {
+					return nil, err
+				}
+				if _, found := byHash[i][h]; !found {
+					byHash[i][h] = relPath
+				}
+			}
+		}
+	next:
+		for h, relPath := range byHash[0] {
+			paths := []string{relPath}
+			for _, others := range byHash[1:] {
+				other, found := others[h]
+				if !found {
+					continue next
+				}
+				paths = append(paths, other)
+			}
+			shared = append(shared, paths)
+		}
+	}
+	sort.Slice(shared, func(i, j int) bool { return shared[i][0] < shared[j][0] })
+	return shared, nil
+}
+
+func allEqual(paths []string) bool {
+	for _, p := range paths[1:] {
+		if p != paths[0] {
+			return false
+		}
+	}
+	return true
+}
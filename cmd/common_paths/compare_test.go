@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for relPath, content := range files {
+		path := filepath.Join(root, relPath)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return root
+}
+
+func readTree(root string) tree {
+	t := tree{root: root, sizes: map[string]int64{}}
+	collectRelFilePaths(root, func(relPath string, d fs.DirEntry) {
+		info, _ := d.Info()
+		t.sizes[relPath] = info.Size()
+	})
+	return t
+}
+
+func TestCompare(t *testing.T) {
+	trees := []tree{
+		readTree(writeTree(t, map[string]string{
+			"A/a.txt":     "aaa",
+			"B/b.txt":     "bbb",
+			"C/same.txt":  "same",
+			"D/moved.txt": "moving",
+			"E/size.txt":  "short",
+		})),
+		readTree(writeTree(t, map[string]string{
+			"A/a.txt":       "AAA",
+			"B/b.txt":       "bbb",
+			"C/same.txt":    "same",
+			"F/renamed.txt": "moving",
+			"E/size.txt":    "longer",
+		})),
+	}
+	cases := map[string][]string{
+		comparePath: {
+			"common\tA/a.txt", "common\tB/b.txt", "common\tC/same.txt", "common\tE/size.txt",
+		},
+		compareSize: {
+			"identical\tA/a.txt", "identical\tB/b.txt", "identical\tC/same.txt", "differing\tE/size.txt",
+		},
+		compareHash: {
+			"identical\tB/b.txt", "identical\tC/same.txt", "moved\tD/moved.txt\tF/renamed.txt",
+		},
+		comparePathHash: {
+			"differing\tA/a.txt", "identical\tB/b.txt", "identical\tC/same.txt", "differing\tE/size.txt",
+			"moved\tD/moved.txt\tF/renamed.txt",
+		},
+	}
+	for mode, expected := range cases {
+		comparisons, err := compare(mode, trees)
+		require.NoError(t, err)
+		lines := make([]string, len(comparisons))
+		for i, c := range comparisons {
+			lines[i] = c.String()
+		}
+		assert.Equal(t, expected, lines, mode)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+func identify(info fs.FileInfo) (inode, int64, bool) {
+	return inode{}, 0, false
+}
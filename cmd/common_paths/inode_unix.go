@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// identify returns the (device, inode) of the file and the bytes it takes on disk.
+func identify(info fs.FileInfo) (inode, int64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inode{}, 0, false
+	}
+	return inode{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)}, int64(stat.Blocks) * 512, true
+}
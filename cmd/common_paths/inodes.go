@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+type inode struct {
+	Device uint64
+	Inode  uint64
+}
+
+// location is a relative path within the directory at index dir.
+type location struct {
+	dir     int
+	relPath string
+}
+
+func (I location) String() string {
+	return fmt.Sprintf("%d:%s", I.dir+1, I.relPath)
+}
+
+// inodeGroup is a file reachable through several paths.
+type inodeGroup struct {
+	inode
+	usage     int64
+	locations []location
+}
+
+// inodeIndex maps each file of the directories to the inode it is.
+type inodeIndex struct {
+	inodes map[location]inode
+	groups map[inode]*inodeGroup
+}
+
+func newInodeIndex() *inodeIndex {
+	return &inodeIndex{inodes: map[location]inode{}, groups: map[inode]*inodeGroup{}}
+}
+
+var errNoInodes = errors.New("inodes are not supported on this platform")
+
+// add indexes the file at loc, returning its size.
+func (I *inodeIndex) add(loc location, d fs.DirEntry) (int64, error) {
+	info, err := d.Info()
+	if err != nil {
+		return 0, err
+	}
+	id, usage, ok := identify(info)
+	if !ok {
+		return 0, errNoInodes
+	}
+	I.inodes[loc] = id
+	group, found := I.groups[id]
+	if !found {
+		group = &inodeGroup{inode: id, usage: usage}
+		I.groups[id] = group
+	}
+	group.locations = append(group.locations, loc)
+	return info.Size(), nil
+}
+
+// sameFile tells whether relPath is the very same file in every directory.
+func (I *inodeIndex) sameFile(relPath string, dirs int) bool {
+	first, found := I.inodes[location{0, relPath}]
+	if !found {
+		return false
+	}
+	for d := 1; d < dirs; d++ {
+		if id, found := I.inodes[location{d, relPath}]; !found || id != first {
+			return false
+		}
+	}
+	return true
+}
+
+// shared returns the inodes reachable through more than one path, sorted by their first location, and the bytes saved by not being copies.
+func (I *inodeIndex) shared() (groups []*inodeGroup, saved int64) {
+	for _, g := range I.groups {
+		if len(g.locations) < 2 {
+			continue
+		}
+		sort.Slice(g.locations, func(i, j int) bool {
+			a, b := g.locations[i], g.locations[j]
+			return a.dir < b.dir || (a.dir == b.dir && a.relPath < b.relPath)
+		})
+		groups = append(groups, g)
+		saved += int64(len(g.locations)-1) * g.usage
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i].locations[0], groups[j].locations[0]
+		return a.dir < b.dir || (a.dir == b.dir && a.relPath < b.relPath)
+	})
+	return
+}
+
+/*
+printInodes writes, for each path common to the trees, whether it's the same file in all of them,
+copies of the same size and content, or different files; then each file reachable through several paths,
+with its locations as DIR:PATH where DIR is the position of the directory in the arguments;
+last the disk usage saved by those shared inodes.
+*/
+func printInodes(w io.Writer, index *inodeIndex, trees []tree) error {
+	for i, t := range trees {
+		fmt.Fprintf(w, "# %d: %s\n", i+1, t.root)
+	}
+	hasher := newHasher()
+	for _, relPath := range commonPaths(trees) {
+		status := "same-file"
+		if !index.sameFile(relPath, len(trees)) {
+			content, err := comparePathAcross(relPath, trees, true, hasher)
+			if err != nil {
+				return err
+			}
+			status = "copies"
+			if content != identical {
+				status = "different-files"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\n", status, relPath)
+	}
+	groups, saved := index.shared()
+	for _, g := range groups {
+		locations := make([]string, len(g.locations))
+		for i, loc := range g.locations {
+			locations[i] = loc.String()
+		}
+		fmt.Fprintf(w, "inode %d:%d\t%s\n", g.Device, g.Inode, strings.Join(locations, "\t"))
+	}
+	fmt.Fprintf(w, "saved\t%d bytes by %d shared inodes\n", saved, len(groups))
+	return nil
+}
+
+// indexInodes collects the inodes of every file in dirs, and the tree of each directory.
+func indexInodes(dirs []string) (*inodeIndex, []tree, error) {
+	index := newInodeIndex()
+	trees := make([]tree, len(dirs))
+	var err error
+	for i, d := range dirs {
+		trees[i] = tree{root: d, sizes: map[string]int64{}}
+		collectRelFilePaths(d, func(relPath string, entry fs.DirEntry) {
+			if err == nil {
+				trees[i].sizes[relPath], err = index.add(location{i, relPath}, entry)
+			}
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return index, trees, nil
+}
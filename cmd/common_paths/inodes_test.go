@@ -0,0 +1,56 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInodes(t *testing.T) {
+	a := writeTree(t, map[string]string{
+		"linked.txt":  "linked",
+		"copied.txt":  "copied",
+		"edited.txt":  "edited",
+		"resized.txt": "resized",
+		"only-a.txt":  "only a",
+	})
+	b := writeTree(t, map[string]string{
+		"copied.txt":  "copied",
+		"edited.txt":  "EDITED",
+		"resized.txt": "resized again",
+	})
+	require.NoError(t, os.Link(filepath.Join(a, "linked.txt"), filepath.Join(b, "linked.txt")))
+	require.NoError(t, os.Link(filepath.Join(a, "linked.txt"), filepath.Join(b, "elsewhere.txt")))
+
+	index, trees, err := indexInodes([]string{a, b})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"copied.txt", "edited.txt", "linked.txt", "resized.txt"}, commonPaths(trees))
+	assert.True(t, index.sameFile("linked.txt", 2))
+	assert.False(t, index.sameFile("copied.txt", 2))
+	assert.False(t, index.sameFile("only-a.txt", 2))
+
+	groups, saved := index.shared()
+	require.Len(t, groups, 1)
+	assert.Equal(t, []location{{0, "linked.txt"}, {1, "elsewhere.txt"}, {1, "linked.txt"}}, groups[0].locations)
+	assert.Equal(t, 2*groups[0].usage, saved)
+
+	var out bytes.Buffer
+	require.NoError(t, printInodes(&out, index, trees))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 8)
+	assert.Equal(t, []string{
+		"copies\tcopied.txt",
+		"different-files\tedited.txt",
+		"same-file\tlinked.txt",
+		"different-files\tresized.txt",
+	}, lines[2:6], "only the same content makes copies")
+	assert.True(t, strings.HasSuffix(lines[6], "\t1:linked.txt\t2:elsewhere.txt\t2:linked.txt"), lines[6])
+	assert.Contains(t, lines[7], "by 1 shared inodes")
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// streamBuffer is how many paths a walker may be ahead of the intersection.
+const streamBuffer = 1024
+
+/*
+walkOrder compares relative paths the way filepath.WalkDir visits them: by name, one path element at a time,
+so that a directory's content comes right after the directory and before its next sibling.
+*/
+func walkOrder(a, b string) int {
+	for {
+		aHead, aTail, aMore := strings.Cut(a, string(filepath.Separator))
+		bHead, bTail, bMore := strings.Cut(b, string(filepath.Separator))
+		if c := strings.Compare(aHead, bHead); c != 0 {
+			return c
+		}
+		switch {
+		case !aMore && !bMore:
+			return 0
+		case !aMore:
+			return -1
+		case !bMore:
+			return 1
+		}
+		a, b = aTail, bTail
+	}
+}
+
+// streamRelFilePaths walks dir in the background and sends its relative file paths, in walk order, until done is closed.
+func streamRelFilePaths(dir string, done <-chan struct{}, walked *atomic.Int64, wg *sync.WaitGroup) <-chan string {
+	paths := make(chan string, streamBuffer)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(paths)
+		walkRelFilePaths(dir, func(relPath string, _ fs.DirEntry) error {
+			walked.Add(1)
+			select {
+			case paths <- relPath:
+				return nil
+			case <-done:
+				return fs.SkipAll
+			}
+		})
+	}()
+	return paths
+}
+
+/*
+intersect walks all dirs at once, and sends to common each path found in all of them, in walk order.
+Being every walk ordered, only the head of each one is held: memory doesn't grow with the size of the trees.
+Once a walk ends nothing else can be in common, so the others are stopped, and waited for.
+*/
+func intersect(dirs []string, walked []atomic.Int64, common func(string)) {
+	done := make(chan struct{})
+	var walkers sync.WaitGroup
+	defer walkers.Wait()
+	defer close(done)
+	streams := make([]<-chan string, len(dirs))
+	for i, d := range dirs {
+		streams[i] = streamRelFilePaths(d, done, &walked[i], &walkers)
+	}
+	heads := make([]string, len(streams))
+	for i, s := range streams {
+		head, ok := <-s
+		if !ok {
+			return
+		}
+		heads[i] = head
+	}
+	for {
+		highest := heads[0]
+		for _, h := range heads[1:] {
+			if walkOrder(h, highest) > 0 {
+				highest = h
+			}
+		}
+		inAll := true
+		for i, s := range streams {
+			for walkOrder(heads[i], highest) < 0 {
+				head, ok := <-s
+				if !ok {
+					return
+				}
+				heads[i] = head
+			}
+			if heads[i] != highest {
+				inAll = false
+			}
+		}
+		if !inAll {
+			continue
+		}
+		common(highest)
+		for i, s := range streams {
+			head, ok := <-s
+			if !ok {
+				return
+			}
+			heads[i] = head
+		}
+	}
+}
+
+// clearLine moves the cursor to the start of the line and erases it.
+const clearLine = "\r\033[K"
+
+// progress rewrites a single line on w with the count of walked and common files, until stopped.
+type progress struct {
+	w      io.Writer
+	walked []atomic.Int64
+	common atomic.Int64
+	stop   chan struct{}
+	done   chan struct{}
+	// mu keeps the results from being written in the middle of the progress line
+	mu    sync.Mutex
+	shown bool
+}
+
+func newProgress(w io.Writer, dirs int) *progress {
+	return &progress{w: w, walked: make([]atomic.Int64, dirs), stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (I *progress) line() string {
+	var walked int64
+	for i := range I.walked {
+		walked += I.walked[i].Load()
+	}
+	return fmt.Sprintf("\rwalked %d files in %d directories, %d in common", walked, len(I.walked), I.common.Load())
+}
+
+func (I *progress) start(every time.Duration) {
+	I.shown = true
+	go func() {
+		defer close(I.done)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				I.mu.Lock()
+				fmt.Fprint(I.w, I.line())
+				I.mu.Unlock()
+			case <-I.stop:
+				I.mu.Lock()
+				fmt.Fprintln(I.w, I.line())
+				I.mu.Unlock()
+				return
+			}
+		}
+	}()
+}
+
+// println writes a result on w, after clearing the progress line, as both may be on the same terminal.
+func (I *progress) println(w io.Writer, result string) {
+	I.mu.Lock()
+	defer I.mu.Unlock()
+	if I.shown {
+		fmt.Fprint(I.w, clearLine)
+	}
+	fmt.Fprintln(w, result)
+}
+
+func (I *progress) finish() {
+	close(I.stop)
+	<-I.done
+}
+
+// stderrIsTerminal tells if a progress line on stderr would be read, rather than pollute a log.
+func stderrIsTerminal() bool {
+	fd := os.Stderr.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkOrderFollowsWalkDir(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a/b":       "",
+		"a.txt":     "",
+		"a-b/c":     "",
+		"a/b.c/d":   "",
+		"a/bc":      "",
+		"b":         "",
+		"A/Z/z.txt": "",
+	})
+	var walked []string
+	collectRelFilePaths(root, func(relPath string, _ fs.DirEntry) { walked = append(walked, relPath) })
+	sorted := append([]string(nil), walked...)
+	sort.Slice(sorted, func(i, j int) bool { return walkOrder(sorted[i], sorted[j]) < 0 })
+	assert.Equal(t, walked, sorted)
+	assert.Less(t, walkOrder(filepath.Join("a", "b"), "a.txt"), 0, "a directory's content comes before its next sibling")
+}
+
+func TestIntersect(t *testing.T) {
+	dirs := []string{
+		writeTree(t, map[string]string{"A/a.txt": "", "A/b.txt": "", "B/c.txt": "", "a.txt": "", "z.txt": ""}),
+		writeTree(t, map[string]string{"A/a.txt": "", "B/c.txt": "", "B/d.txt": "", "a.txt": "", "z.txt": ""}),
+		writeTree(t, map[string]string{"A/a.txt": "", "B/c.txt": "", "a.txt": "", "y.txt": ""}),
+	}
+	walked := make([]atomic.Int64, len(dirs))
+	var common []string
+	intersect(dirs, walked, func(relPath string) { common = append(common, relPath) })
+	assert.Equal(t, []string{filepath.Join("A", "a.txt"), filepath.Join("B", "c.txt"), "a.txt"}, common)
+
+	trees := make([]tree, len(dirs))
+	for i, d := range dirs {
+		trees[i] = readTree(d)
+	}
+	expected := commonPaths(trees)
+	sort.Strings(common)
+	assert.Equal(t, expected, common, "streaming should find what the sets do")
+}
+
+func TestIntersectStopsAtTheShortestWalk(t *testing.T) {
+	dirs := []string{
+		writeTree(t, map[string]string{}),
+		writeTree(t, map[string]string{"a.txt": "", "b.txt": ""}),
+	}
+	walked := make([]atomic.Int64, len(dirs))
+	intersect(dirs, walked, func(relPath string) { t.Errorf("nothing is common, got %q", relPath) })
+}
+
+func TestProgress(t *testing.T) {
+	var out bytes.Buffer
+	p := newProgress(&out, 2)
+	p.walked[0].Add(3)
+	p.walked[1].Add(4)
+	p.common.Add(2)
+	p.start(time.Hour)
+	p.finish()
+	require.NotEmpty(t, out.String())
+	assert.Equal(t, "\rwalked 7 files in 2 directories, 2 in common\n", out.String())
+}
+
+func TestProgressIsClearedBeforeEachResult(t *testing.T) {
+	var terminal bytes.Buffer
+	p := newProgress(&terminal, 1)
+	p.println(&terminal, "a.pdf")
+	assert.Equal(t, "a.pdf\n", terminal.String(), "nothing to clear while the progress isn't shown")
+
+	terminal.Reset()
+	p.start(time.Hour)
+	p.println(&terminal, "b.pdf")
+	p.finish()
+	assert.Equal(t, clearLine+"b.pdf\n\rwalked 0 files in 1 directories, 0 in common\n", terminal.String())
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"dev.acorello.it/go/arkivist/sets"
+)
+
+// where a path is found, relatively to the N directories
+const (
+	inAll  = "in-all"
+	inSome = "in-some"
+	onlyIn = "only-in"
+)
+
+// Membership tells in which directories, by their index in the arguments, a relative path is found.
+type Membership struct {
+	Path     string `json:"path"`
+	In       []int  `json:"in"`
+	Category string `json:"category"`
+}
+
+// Region is a part of the Venn diagram: the paths found in exactly the same directories.
+type Region struct {
+	In       []int  `json:"in"`
+	Category string `json:"category"`
+	Paths    int    `json:"paths"`
+}
+
+type TreeDiff struct {
+	Dirs    []string     `json:"dirs"`
+	Paths   []Membership `json:"paths"`
+	Regions []Region     `json:"regions"`
+}
+
+func category(in []int, dirs int) string {
+	switch len(in) {
+	case dirs:
+		return inAll
+	case 1:
+		return onlyIn
+	default:
+		return inSome
+	}
+}
+
+// treeDiff tells the membership of each path of the union of the directories' paths, sorted by path; regions are sorted by the directories they span.
+func treeDiff(dirs []string, paths []sets.Set[string]) TreeDiff {
+	union := sets.New[string]()
+	for _, p := range paths {
+		union = union.Union(p)
+	}
+	diff := TreeDiff{Dirs: dirs, Paths: []Membership{}, Regions: []Region{}}
+	regions := map[string]*Region{}
+	for _, relPath := range union.Entries() {
+		var in []int
+		for i, p := range paths {
+			if p.Contains(relPath) {
+				in = append(in, i)
+			}
+		}
+		m := Membership{Path: relPath, In: in, Category: category(in, len(dirs))}
+		diff.Paths = append(diff.Paths, m)
+		key := fmt.Sprint(in)
+		if regions[key] == nil {
+			regions[key] = &Region{In: in, Category: m.Category}
+		}
+		regions[key].Paths++
+	}
+	sort.Slice(diff.Paths, func(i, j int) bool { return diff.Paths[i].Path < diff.Paths[j].Path })
+	for _, r := range regions {
+		diff.Regions = append(diff.Regions, *r)
+	}
+	sort.Slice(diff.Regions, func(i, j int) bool { return lessIndexes(diff.Regions[i].In, diff.Regions[j].In) })
+	return diff
+}
+
+// lessIndexes orders the larger sets first, then lexicographically.
+func lessIndexes(a, b []int) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func label(in []int) string {
+	labels := make([]string, len(in))
+	for i, d := range in {
+		labels[i] = strconv.Itoa(d + 1)
+	}
+	return strings.Join(labels, ",")
+}
+
+// printTable writes a legend of the directories, a row per path with a mark under each directory holding it, and the size of each region.
+func printTable(w io.Writer, diff TreeDiff) {
+	for i, d := range diff.Dirs {
+		fmt.Fprintf(w, "%d: %s\n", i+1, d)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i := range diff.Dirs {
+		fmt.Fprintf(tw, "%d\t", i+1)
+	}
+	fmt.Fprintln(tw, "path\tcategory")
+	for _, m := range diff.Paths {
+		marks := make([]string, len(diff.Dirs))
+		for i := range marks {
+			marks[i] = "."
+		}
+		for _, d := range m.In {
+			marks[d] = "x"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.Join(marks, "\t"), m.Path, categoryLabel(m.Category, m.In))
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, r := range diff.Regions {
+		fmt.Fprintf(tw, "%s\t%d\t\n", categoryLabel(r.Category, r.In), r.Paths)
+	}
+	tw.Flush()
+}
+
+func categoryLabel(category string, in []int) string {
+	if category == inAll {
+		return category
+	}
+	return category + " " + label(in)
+}
+
+// treeDiffCommand implements the `treediff` sub-command: `common_paths treediff [-format table|json] DIR1 DIR2 [...DIRN]`.
+func treeDiffCommand(args []string) {
+	flags := flag.NewFlagSet("treediff", flag.ExitOnError)
+	format := flags.String("format", "table", "output format: table or json")
+	setUpWalking := walkFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: common_paths treediff [-format table|json] [-exclude PATTERN] [-ignore-file NAME] [-follow-symlinks] DIR1 DIR2 [...DIRN]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	setUpWalking()
+	if *format != "table" && *format != "json" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	dirs := validatedDirs(flags.Args())
+	paths := make([]sets.Set[string], len(dirs))
+	for i, d := range dirs {
+		paths[i] = sets.New[string]()
+		collectRelFilePaths(d, func(relPath string, _ fs.DirEntry) { paths[i].Add(relPath) })
+	}
+	diff := treeDiff(dirs, paths)
+	if *format == "table" {
+		printTable(os.Stdout, diff)
+		return
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(diff); err != nil {
+		log.Fatal(err)
+	}
+}
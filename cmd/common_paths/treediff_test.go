@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"dev.acorello.it/go/arkivist/sets"
+)
+
+func setOf(paths ...string) sets.Set[string] {
+	s := sets.New[string]()
+	for _, p := range paths {
+		s.Add(p)
+	}
+	return s
+}
+
+func TestTreeDiff(t *testing.T) {
+	diff := treeDiff([]string{"/x", "/y", "/z"}, []sets.Set[string]{
+		setOf("A/a.txt", "b.txt", "only-x.txt"),
+		setOf("A/a.txt", "b.txt", "c.txt"),
+		setOf("A/a.txt", "c.txt"),
+	})
+	assert.Equal(t, []Membership{
+		{Path: "A/a.txt", In: []int{0, 1, 2}, Category: inAll},
+		{Path: "b.txt", In: []int{0, 1}, Category: inSome},
+		{Path: "c.txt", In: []int{1, 2}, Category: inSome},
+		{Path: "only-x.txt", In: []int{0}, Category: onlyIn},
+	}, diff.Paths)
+	assert.Equal(t, []Region{
+		{In: []int{0, 1, 2}, Category: inAll, Paths: 1},
+		{In: []int{0, 1}, Category: inSome, Paths: 1},
+		{In: []int{1, 2}, Category: inSome, Paths: 1},
+		{In: []int{0}, Category: onlyIn, Paths: 1},
+	}, diff.Regions)
+
+	var out bytes.Buffer
+	printTable(&out, diff)
+	assert.Equal(t, `1: /x
+2: /y
+3: /z
+
+1  2  3  path        category
+x  x  x  A/a.txt     in-all
+x  x  .  b.txt       in-some 1,2
+.  x  x  c.txt       in-some 2,3
+x  .  .  only-x.txt  only-in 1
+
+       in-all  1
+  in-some 1,2  1
+  in-some 2,3  1
+    only-in 1  1
+`, out.String())
+}
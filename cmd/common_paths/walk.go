@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultExcludes are the files no one means to compare; a `-exclude '!PATTERN'` brings them back.
+var defaultExcludes = []string{".DS_Store", "Thumbs.db", "desktop.ini", ".git/"}
+
+/*
+ignoreRule is a line of a .gitignore-style file:
+
+  - a pattern without a slash matches the name of a file or directory at any depth
+  - a pattern with a slash, other than a trailing one, matches the path relative to the directory of the ignore file
+  - `**` matches any number of directories, the other elements are filepath.Match patterns
+  - a trailing slash matches only directories
+  - a leading `!` brings back what a previous rule ignored, unless a parent directory is ignored
+*/
+type ignoreRule struct {
+	// base is the slash-separated directory of the ignore file, relative to the walked root; empty for -exclude
+	base     string
+	elements []string
+	dirOnly  bool
+	negated  bool
+}
+
+// parseIgnoreRule returns false for blank lines and comments.
+func parseIgnoreRule(base, line string) (ignoreRule, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false, nil
+	}
+	rule := ignoreRule{base: base}
+	line, rule.negated = strings.CutPrefix(line, "!")
+	line, rule.dirOnly = strings.CutSuffix(line, "/")
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignoreRule{}, false, nil
+	}
+	rule.elements = strings.Split(line, "/")
+	if !anchored {
+		rule.elements = append([]string{"**"}, rule.elements...)
+	}
+	for _, e := range rule.elements {
+		if _, err := path.Match(e, ""); err != nil {
+			return ignoreRule{}, false, fmt.Errorf("invalid pattern %q: %w", line, err)
+		}
+	}
+	return rule, true, nil
+}
+
+// matches tells if the rule applies to relPath, slash-separated and relative to the walked root.
+func (I ignoreRule) matches(relPath string, isDir bool) bool {
+	if I.dirOnly && !isDir {
+		return false
+	}
+	if I.base != "" {
+		var found bool
+		if relPath, found = strings.CutPrefix(relPath, I.base+"/"); !found {
+			return false
+		}
+	}
+	return matchElements(I.elements, strings.Split(relPath, "/"))
+}
+
+func matchElements(pattern, elements []string) bool {
+	if len(pattern) == 0 {
+		return len(elements) == 0
+	}
+	if pattern[0] == "**" {
+		return matchElements(pattern[1:], elements) || (len(elements) > 0 && matchElements(pattern, elements[1:]))
+	}
+	if len(elements) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], elements[0])
+	return matched && matchElements(pattern[1:], elements[1:])
+}
+
+// ignored applies the rules in order: the last one matching decides.
+func ignored(rules []ignoreRule, relPath string, isDir bool) bool {
+	ignore := false
+	for _, r := range rules {
+		if r.matches(relPath, isDir) {
+			ignore = !r.negated
+		}
+	}
+	return ignore
+}
+
+// readIgnoreFile returns the rules of the ignore file, none if it doesn't exist.
+func readIgnoreFile(filePath, base string) ([]ignoreRule, error) {
+	f, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rule, ok, err := parseIgnoreRule(base, scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+/*
+walker lists the files of a directory in the same order as filepath.WalkDir, leaving out what the rules ignore;
+an ignored directory is not descended into.
+*/
+type walker struct {
+	excludes []ignoreRule
+	// ignoreFile is the name of the files whose rules apply to their directory, and below; none when empty
+	ignoreFile string
+	// followSymlinks walks the directories, and lists the files, that symlinks point to, instead of listing the symlinks
+	followSymlinks bool
+}
+
+// walking is how every directory is walked.
+var walking walker
+
+func newWalker(excludes []string, ignoreFile string, followSymlinks bool) (walker, error) {
+	w := walker{ignoreFile: ignoreFile, followSymlinks: followSymlinks}
+	for _, e := range append(append([]string(nil), defaultExcludes...), excludes...) {
+		rule, ok, err := parseIgnoreRule("", e)
+		if err != nil {
+			return walker{}, err
+		}
+		if ok {
+			w.excludes = append(w.excludes, rule)
+		}
+	}
+	return w, nil
+}
+
+// walk visits the files under root, by path relative to it, until visit returns fs.SkipAll or an error.
+func (I walker) walk(root string, visit func(string, fs.DirEntry) error) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	err = I.walkDir(root, "", []string{realRoot}, I.excludes, visit)
+	if err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir walks the directory at relDir, whose real path is the last of chain, the real paths of the directories descended through.
+func (I walker) walkDir(root, relDir string, chain []string, rules []ignoreRule, visit func(string, fs.DirEntry) error) error {
+	dir := filepath.Join(root, relDir)
+	realDir := chain[len(chain)-1]
+	if I.ignoreFile != "" {
+		more, err := readIgnoreFile(filepath.Join(dir, I.ignoreFile), filepath.ToSlash(relDir))
+		if err != nil {
+			return err
+		}
+		// a full slice expression, for the rules of a directory not to end up in its sibling's
+		rules = append(rules[:len(rules):len(rules)], more...)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		relPath := filepath.Join(relDir, entry.Name())
+		realPath := filepath.Join(realDir, entry.Name())
+		if I.followSymlinks && entry.Type()&fs.ModeSymlink != 0 {
+			var cycle bool
+			if entry, realPath, cycle = I.follow(entry, filepath.Join(dir, entry.Name()), chain); cycle {
+				log.Printf("not following %q: it leads back to %q", filepath.Join(dir, entry.Name()), realPath)
+				continue
+			}
+		}
+		if ignored(rules, filepath.ToSlash(relPath), entry.IsDir()) {
+			continue
+		}
+		if entry.IsDir() {
+			// a full slice expression, for the chain of a directory not to end up in its sibling's
+			err = I.walkDir(root, relPath, append(chain[:len(chain):len(chain)], realPath), rules, visit)
+		} else {
+			err = visit(relPath, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+follow returns the entry of what the symlink at linkPath points to, and its real path;
+a broken symlink is left as it is.
+It tells a cycle when the symlink points to a directory of chain, the real paths descended through to get where it is,
+or to any directory above the last one, like a symlink pointing at a sibling whose symlink points back.
+*/
+func (I walker) follow(link fs.DirEntry, linkPath string, chain []string) (fs.DirEntry, string, bool) {
+	target, err := os.Stat(linkPath)
+	if err != nil {
+		return link, linkPath, false
+	}
+	realPath, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		return link, linkPath, false
+	}
+	if !target.IsDir() {
+		return fs.FileInfoToDirEntry(target), realPath, false
+	}
+	sep := string(filepath.Separator)
+	if strings.HasPrefix(chain[len(chain)-1]+sep, strings.TrimSuffix(realPath, sep)+sep) {
+		return link, realPath, true
+	}
+	for _, dir := range chain {
+		if dir == realPath {
+			return link, realPath, true
+		}
+	}
+	return fs.FileInfoToDirEntry(target), realPath, false
+}
+
+// walkFlags adds the options of the walk to flags; once they're parsed, the returned function sets up walking.
+func walkFlags(flags *flag.FlagSet) func() {
+	excludes := new(excludePatterns)
+	flags.Var(excludes, "exclude", fmt.Sprintf("ignore files and directories matching the .gitignore-style pattern; can be repeated; %s are excluded unless brought back with '!PATTERN'", strings.Join(defaultExcludes, ", ")))
+	ignoreFile := flags.String("ignore-file", ".ignore", "name of the .gitignore-style files whose patterns apply to their directory and below; empty to read none")
+	followSymlinks := flags.Bool("follow-symlinks", false, "walk the directories, and compare the files, symlinks point to; symlinks leading back to a directory above are skipped")
+	return func() {
+		w, err := newWalker(*excludes, *ignoreFile, *followSymlinks)
+		if err != nil {
+			log.Fatal(err)
+		}
+		walking = w
+	}
+}
+
+// excludePatterns is a repeatable flag of .gitignore-style patterns.
+type excludePatterns []string
+
+func (me *excludePatterns) String() string {
+	if me == nil {
+		return ""
+	}
+	return strings.Join(*me, " ")
+}
+
+func (me *excludePatterns) Set(pattern string) error {
+	if _, _, err := parseIgnoreRule("", pattern); err != nil {
+		return err
+	}
+	*me = append(*me, pattern)
+	return nil
+}
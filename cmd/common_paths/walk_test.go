@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rule := func(base, line string) ignoreRule {
+		r, ok, err := parseIgnoreRule(base, line)
+		require.NoError(t, err)
+		require.True(t, ok)
+		return r
+	}
+	cases := []struct {
+		rule    ignoreRule
+		relPath string
+		isDir   bool
+		matches bool
+	}{
+		{rule("", "*.part"), "a/b/c.part", false, true},
+		{rule("", "*.part"), "c.part.pdf", false, false},
+		{rule("", "build/"), "a/build", true, true},
+		{rule("", "build/"), "a/build", false, false},
+		{rule("", "/top.txt"), "top.txt", false, true},
+		{rule("", "/top.txt"), "a/top.txt", false, false},
+		{rule("", "docs/*.md"), "docs/a.md", false, true},
+		{rule("", "docs/*.md"), "x/docs/a.md", false, false},
+		{rule("", "**/cache/*.bin"), "x/y/cache/a.bin", false, true},
+		{rule("", "a/**/z"), "a/z", false, true},
+		{rule("", "a/**/z"), "a/b/c/z", false, true},
+		{rule("sub", "*.tmp"), "sub/x/a.tmp", false, true},
+		{rule("sub", "*.tmp"), "other/a.tmp", false, false},
+		{rule("sub", "/a.tmp"), "sub/a.tmp", false, true},
+		{rule("sub", "/a.tmp"), "sub/x/a.tmp", false, false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.matches, tc.rule.matches(tc.relPath, tc.isDir), "%+v on %q", tc.rule, tc.relPath)
+	}
+
+	_, ok, err := parseIgnoreRule("", "# a comment")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	_, _, err = parseIgnoreRule("", "[")
+	assert.Error(t, err)
+
+	rules := []ignoreRule{rule("", "*.log"), rule("", "!keep.log")}
+	assert.True(t, ignored(rules, "a.log", false))
+	assert.False(t, ignored(rules, "x/keep.log", false), "the last matching rule decides")
+}
+
+func walkedPaths(t *testing.T, w walker, root string) []string {
+	t.Helper()
+	var paths []string
+	require.NoError(t, w.walk(root, func(relPath string, _ fs.DirEntry) error {
+		paths = append(paths, filepath.ToSlash(relPath))
+		return nil
+	}))
+	return paths
+}
+
+func TestWalkerIgnores(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".DS_Store":         "",
+		".git/HEAD":         "",
+		"a/Thumbs.db":       "",
+		"a/book.pdf":        "",
+		"a/book.pdf.part":   "",
+		"a/.ignore":         "*.txt\n!keep.txt\n",
+		"a/notes.txt":       "",
+		"a/keep.txt":        "",
+		"a/b/more.txt":      "",
+		"b/notes.txt":       "",
+		"tmp/something.pdf": "",
+	})
+	w, err := newWalker([]string{"*.part", "tmp/"}, ".ignore", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/.ignore", "a/book.pdf", "a/keep.txt", "b/notes.txt"}, walkedPaths(t, w, root))
+
+	w, err = newWalker([]string{"!.git/"}, "", false)
+	require.NoError(t, err)
+	assert.Contains(t, walkedPaths(t, w, root), ".git/HEAD", "default excludes can be brought back")
+	assert.NotContains(t, walkedPaths(t, w, root), ".DS_Store")
+
+	assert.Len(t, walkedPaths(t, walker{}, root), 11, "the zero walker lists everything")
+}
+
+func TestWalkerStops(t *testing.T) {
+	root := writeTree(t, map[string]string{"a": "", "b": "", "c": ""})
+	var paths []string
+	require.NoError(t, walker{}.walk(root, func(relPath string, _ fs.DirEntry) error {
+		paths = append(paths, relPath)
+		if len(paths) == 2 {
+			return fs.SkipAll
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"a", "b"}, paths)
+	_, err := os.Stat(root)
+	require.NoError(t, err)
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkerFollowsSymlinks(t *testing.T) {
+	root := writeTree(t, map[string]string{"a/file.txt": ""})
+	outside := writeTree(t, map[string]string{"shared/doc.txt": "", "single.txt": ""})
+	require.NoError(t, os.Symlink(filepath.Join(outside, "shared"), filepath.Join(root, "a", "shared")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "single.txt"), filepath.Join(root, "single.txt")))
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "a", "loop")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "broken")))
+
+	assert.Equal(t, []string{"a/file.txt", "a/loop", "a/shared", "broken", "single.txt"}, walkedPaths(t, walker{}, root),
+		"symlinks are listed as they are, when not followed")
+	assert.Equal(t, []string{"a/file.txt", "a/shared/doc.txt", "broken", "single.txt"}, walkedPaths(t, walker{followSymlinks: true}, root),
+		"the loop back to the root is skipped, the broken link is listed")
+}
+
+func TestWalkerSkipsSiblingSymlinksPointingAtEachOther(t *testing.T) {
+	root := writeTree(t, map[string]string{"a/a.txt": "", "b/b.txt": ""})
+	require.NoError(t, os.Symlink(filepath.Join("..", "b"), filepath.Join(root, "a", "l1")))
+	require.NoError(t, os.Symlink(filepath.Join("..", "a"), filepath.Join(root, "b", "l2")))
+
+	assert.Equal(t, []string{"a/a.txt", "a/l1/b.txt", "b/b.txt", "b/l2/a.txt"}, walkedPaths(t, walker{followSymlinks: true}, root),
+		"each link is followed once, not back through the other")
+}
@@ -0,0 +1,90 @@
+// Package bookmeta reads the bibliographic metadata embedded in EPUB and PDF files.
+package bookmeta
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Metadata of a book; any field may be empty.
+type Metadata struct {
+	Title       string
+	Authors     []string
+	Publisher   string
+	Identifiers []string
+	// Date as found in the book, usually starting with the year
+	Date string
+}
+
+var ErrUnsupported = errors.New("unsupported file format")
+
+// Read the metadata of the EPUB or PDF at filePath, recognized by extension.
+func Read(filePath string) (Metadata, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".epub":
+		return readEPUB(filePath)
+	case ".pdf":
+		return readPDF(filePath)
+	default:
+		return Metadata{}, ErrUnsupported
+	}
+}
+
+// Author joins the authors with ", ".
+func (I Metadata) Author() string {
+	return strings.Join(I.Authors, ", ")
+}
+
+var isbnSeparators = strings.NewReplacer("-", "", " ", "")
+
+// a bare ISBN-13 or ISBN-10, once separators are removed
+var isbnPattern = regexp.MustCompile(`^(?:97[89]\d{10}|\d{9}[\dX])$`)
+
+// ISBN is the first identifier that is an ISBN, without separators nor any "urn:isbn:" prefix.
+func (I Metadata) ISBN() string {
+	for _, id := range I.Identifiers {
+		id = strings.ToUpper(isbnSeparators.Replace(strings.TrimSpace(id)))
+		id = strings.TrimPrefix(strings.TrimPrefix(id, "URN:ISBN:"), "ISBN:")
+		if isbnPattern.MatchString(id) {
+			return id
+		}
+	}
+	return ""
+}
+
+// Year is the leading year of Date, if any.
+func (I Metadata) Year() string {
+	if len(I.Date) >= 4 && isDigits(I.Date[:4]) {
+		return I.Date[:4]
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func firstNonBlank(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func nonBlank(values []string) (res []string) {
+	for _, v := range values {
+		if v = strings.Join(strings.Fields(v), " "); v != "" {
+			res = append(res, v)
+		}
+	}
+	return
+}
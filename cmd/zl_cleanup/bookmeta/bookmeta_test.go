@@ -0,0 +1,148 @@
+package bookmeta
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const containerXML = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+const contentOPF = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:title>Drive</dc:title>
+    <dc:creator opf:role="aut">Daniel H. Pink</dc:creator>
+    <dc:publisher>Riverhead Books</dc:publisher>
+    <dc:identifier opf:scheme="UUID">d2b2b4a0-0000-4000-8000-000000000000</dc:identifier>
+    <dc:identifier id="id" opf:scheme="ISBN">978-1-101-15214-0</dc:identifier>
+    <dc:date>2011-04-05</dc:date>
+  </metadata>
+</package>`
+
+func writeEPUB(t *testing.T, files map[string]string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(filePath)
+	require.NoError(t, err)
+	defer f.Close()
+	archive := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	return filePath
+}
+
+func TestReadEPUB(t *testing.T) {
+	filePath := writeEPUB(t, map[string]string{
+		"mimetype":               "application/epub+zip",
+		"META-INF/container.xml": containerXML,
+		"OEBPS/content.opf":      contentOPF,
+	})
+	metadata, err := Read(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "Drive", metadata.Title)
+	assert.Equal(t, "Daniel H. Pink", metadata.Author())
+	assert.Equal(t, "Riverhead Books", metadata.Publisher)
+	assert.Equal(t, "9781101152140", metadata.ISBN())
+	assert.Equal(t, "2011", metadata.Year())
+}
+
+func TestReadEPUBWithoutPackage(t *testing.T) {
+	filePath := writeEPUB(t, map[string]string{"mimetype": "application/epub+zip"})
+	_, err := Read(filePath)
+	assert.Error(t, err)
+}
+
+func TestReadPDFInfo(t *testing.T) {
+	pdf := "%PDF-1.4\n" +
+		"1 0 obj\n<< /Type /Catalog >>\nendobj\n" +
+		"2 0 obj\n<< /Producer (pdfTeX) /Title (Structure and Interpretation \\(2nd ed.\\)) " +
+		"/Author <FEFF004100620065006C0073006F006E> /Creator (LaTeX) >>\nendobj\n" +
+		"trailer\n<< /Root 1 0 R /Info 2 0 R >>\n%%EOF\n"
+	filePath := filepath.Join(t.TempDir(), "book.pdf")
+	require.NoError(t, os.WriteFile(filePath, []byte(pdf), 0o644))
+	metadata, err := Read(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "Structure and Interpretation (2nd ed.)", metadata.Title)
+	assert.Equal(t, []string{"Abelson"}, metadata.Authors)
+}
+
+func TestReadPDFPrefersXMP(t *testing.T) {
+	pdf := "%PDF-1.6\n" +
+		"2 0 obj\n<< /Title (untitled.dvi) >>\nendobj\n" +
+		"3 0 obj\n<< /Type /Metadata /Subtype /XML >>\nstream\n" +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+		`<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Programming Erlang</rdf:li></rdf:Alt></dc:title>` +
+		`<dc:creator><rdf:Seq><rdf:li>Joe Armstrong</rdf:li></rdf:Seq></dc:creator>` +
+		`<dc:publisher><rdf:Bag><rdf:li>Pragmatic Bookshelf</rdf:li></rdf:Bag></dc:publisher>` +
+		`<dc:identifier>urn:isbn:193435600X</dc:identifier>` +
+		`</rdf:Description></rdf:RDF></x:xmpmeta>` +
+		"\nendstream\nendobj\n" +
+		"trailer\n<< /Info 2 0 R >>\n%%EOF\n"
+	filePath := filepath.Join(t.TempDir(), "book.pdf")
+	require.NoError(t, os.WriteFile(filePath, []byte(pdf), 0o644))
+	metadata, err := Read(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "Programming Erlang", metadata.Title)
+	assert.Equal(t, "Joe Armstrong", metadata.Author())
+	assert.Equal(t, "Pragmatic Bookshelf", metadata.Publisher)
+	assert.Equal(t, "193435600X", metadata.ISBN())
+}
+
+func TestReadPDFReadsOnlyHeadTailAndInfo(t *testing.T) {
+	padding := func(object int) string {
+		return fmt.Sprintf("%d 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", object, pdfWindow, strings.Repeat("x", pdfWindow))
+	}
+	var pdf strings.Builder
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := []int{}
+	offsets = append(offsets, pdf.Len())
+	pdf.WriteString("1 0 obj\n<< /Type /Metadata /Subtype /XML >>\nstream\n" +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+		`<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Programming Erlang</rdf:li></rdf:Alt></dc:title>` +
+		`</rdf:Description></rdf:RDF></x:xmpmeta>` +
+		"\nendstream\nendobj\n")
+	offsets = append(offsets, pdf.Len())
+	pdf.WriteString(padding(2))
+	// the Info dictionary is in neither the head nor the tail: only the cross-reference table tells where
+	offsets = append(offsets, pdf.Len())
+	pdf.WriteString("3 0 obj\n<< /Author (Joe Armstrong) >>\nendobj\n")
+	offsets = append(offsets, pdf.Len())
+	pdf.WriteString(padding(4))
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	filePath := filepath.Join(t.TempDir(), "book.pdf")
+	require.NoError(t, os.WriteFile(filePath, []byte(pdf.String()), 0o644))
+
+	metadata, err := Read(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "Programming Erlang", metadata.Title, "the XMP packet is found in the head")
+	assert.Equal(t, "Joe Armstrong", metadata.Author(), "the Info dictionary is found through the cross-reference table")
+}
+
+func TestReadUnsupported(t *testing.T) {
+	_, err := Read("notes.txt")
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
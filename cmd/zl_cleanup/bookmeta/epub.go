@@ -0,0 +1,67 @@
+package bookmeta
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// the Dublin Core elements of an OPF package document
+type opfPackage struct {
+	Titles      []string `xml:"metadata>title"`
+	Creators    []string `xml:"metadata>creator"`
+	Publishers  []string `xml:"metadata>publisher"`
+	Identifiers []string `xml:"metadata>identifier"`
+	Dates       []string `xml:"metadata>date"`
+}
+
+func readEPUB(filePath string) (Metadata, error) {
+	book, err := zip.OpenReader(filePath)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer book.Close()
+	var container epubContainer
+	if err := decodeZipXML(&book.Reader, "META-INF/container.xml", &container); err != nil {
+		return Metadata{}, err
+	}
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType != "" && rootfile.MediaType != "application/oebps-package+xml" {
+			continue
+		}
+		var opf opfPackage
+		if err := decodeZipXML(&book.Reader, rootfile.FullPath, &opf); err != nil {
+			return Metadata{}, err
+		}
+		return Metadata{
+			Title:       firstNonBlank(opf.Titles...),
+			Authors:     nonBlank(opf.Creators),
+			Publisher:   firstNonBlank(opf.Publishers...),
+			Identifiers: nonBlank(opf.Identifiers),
+			Date:        firstNonBlank(opf.Dates...),
+		}, nil
+	}
+	return Metadata{}, fmt.Errorf("%s: no OPF package document", filePath)
+}
+
+func decodeZipXML(archive *zip.Reader, name string, v any) error {
+	f, err := archive.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decoder := xml.NewDecoder(f)
+	// some books declare encodings other than UTF-8, their metadata is usually ASCII anyway
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder.Decode(v)
+}
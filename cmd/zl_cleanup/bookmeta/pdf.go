@@ -0,0 +1,350 @@
+package bookmeta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfWindow is how much of the head, and of the tail, of a PDF is scanned: metadata is expected near either end.
+const pdfWindow = 1 << 20
+
+// pdfObjectWindow is how much is read where the cross-reference table places an object.
+const pdfObjectWindow = 64 << 10
+
+/*
+readPDF looks for the document Info dictionary and the XMP metadata packet, preferring the latter.
+
+It's a heuristic scan, not a PDF parser: only the head and the tail of the file are read, along with the Info
+dictionary where the cross-reference table places it; metadata stored in compressed object streams is not found.
+*/
+func readPDF(filePath string) (Metadata, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return Metadata{}, err
+	}
+	size := stat.Size()
+	head, err := readAt(f, 0, pdfWindow, size)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if !bytes.HasPrefix(head, []byte("%PDF-")) {
+		return Metadata{}, fmt.Errorf("%s: not a PDF", filePath)
+	}
+	tail := head
+	if size > pdfWindow {
+		if tail, err = readAt(f, size-pdfWindow, pdfWindow, size); err != nil {
+			return Metadata{}, err
+		}
+	}
+	info := pdfInfo(f, size, tail, head)
+	xmp := pdfXMP(tail, head)
+	authors := xmp.Authors
+	if len(authors) == 0 {
+		authors = nonBlank(nonEmpty(info["Author"]))
+	}
+	return Metadata{
+		Title:       firstNonBlank(xmp.Title, info["Title"]),
+		Authors:     authors,
+		Publisher:   xmp.Publisher,
+		Identifiers: xmp.Identifiers,
+		Date:        xmp.Date,
+	}, nil
+}
+
+// readAt reads up to n bytes at offset.
+func readAt(r io.ReaderAt, offset, n, size int64) ([]byte, error) {
+	if offset+n > size {
+		n = size - offset
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+var (
+	infoReference  = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	startXRef      = regexp.MustCompile(`startxref\s+(\d+)`)
+	xrefSubsection = regexp.MustCompile(`^(\d+)\s+(\d+)$`)
+)
+
+/*
+pdfInfo returns the text entries of the Info dictionary referenced by the last trailer: it's looked for where
+the cross-reference table places it, and else in the windows, the tail and then the head of the file.
+*/
+func pdfInfo(r io.ReaderAt, size int64, windows ...[]byte) map[string]string {
+	var ref [][]byte
+	for _, w := range windows {
+		if refs := infoReference.FindAllSubmatch(w, -1); len(refs) > 0 {
+			ref = refs[len(refs)-1]
+			break
+		}
+	}
+	if ref == nil {
+		return nil
+	}
+	objStart := regexp.MustCompile(fmt.Sprintf(`(?:^|\s)%s\s+%s\s+obj\s*<<`, ref[1], ref[2]))
+	object, _ := strconv.ParseInt(string(ref[1]), 10, 64)
+	if offset, found := objectOffset(r, size, windows[0], object); found {
+		if chunk, err := readAt(r, offset, pdfObjectWindow, size); err == nil {
+			windows = append([][]byte{chunk}, windows...)
+		}
+	}
+	for _, w := range windows {
+		if loc := objStart.FindIndex(w); loc != nil {
+			return parseDictionaryStrings(w[loc[1]:])
+		}
+	}
+	return nil
+}
+
+/*
+objectOffset looks the object up in the cross-reference table that tail points to with `startxref`;
+earlier tables of incrementally updated files, and tables compressed in streams, are not read.
+*/
+func objectOffset(r io.ReaderAt, size int64, tail []byte, object int64) (int64, bool) {
+	refs := startXRef.FindAllSubmatch(tail, -1)
+	if len(refs) == 0 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(string(refs[len(refs)-1][1]), 10, 64)
+	if err != nil || start >= size {
+		return 0, false
+	}
+	table := bufio.NewReader(io.NewSectionReader(r, start, size-start))
+	if line, _ := table.ReadString('\n'); strings.TrimSpace(line) != "xref" {
+		return 0, false
+	}
+	for {
+		line, err := table.ReadString('\n')
+		if err != nil {
+			return 0, false
+		}
+		// the subsections end at the trailer
+		subsection := xrefSubsection.FindStringSubmatch(strings.TrimSpace(line))
+		if subsection == nil {
+			return 0, false
+		}
+		first, _ := strconv.ParseInt(subsection[1], 10, 64)
+		count, _ := strconv.ParseInt(subsection[2], 10, 64)
+		if object < first || first+count <= object {
+			// each entry is exactly 20 bytes long
+			if _, err := table.Discard(int(count * 20)); err != nil {
+				return 0, false
+			}
+			continue
+		}
+		if _, err := table.Discard(int((object - first) * 20)); err != nil {
+			return 0, false
+		}
+		entry := make([]byte, 20)
+		if _, err := io.ReadFull(table, entry); err != nil {
+			return 0, false
+		}
+		fields := strings.Fields(string(entry))
+		if len(fields) != 3 || fields[2] != "n" {
+			return 0, false
+		}
+		offset, err := strconv.ParseInt(fields[0], 10, 64)
+		return offset, err == nil && offset < size
+	}
+}
+
+// parseDictionaryStrings reads the /Key (string) and /Key <hex> entries of a dictionary, up to its closing >>.
+func parseDictionaryStrings(dict []byte) map[string]string {
+	entries := map[string]string{}
+	for i := 0; i < len(dict); {
+		switch {
+		case bytes.HasPrefix(dict[i:], []byte(">>")):
+			return entries
+		case dict[i] == '/':
+			start := i + 1
+			i++
+			for i < len(dict) && !isPDFDelimiter(dict[i]) {
+				i++
+			}
+			key := string(dict[start:i])
+			for i < len(dict) && isPDFSpace(dict[i]) {
+				i++
+			}
+			if i >= len(dict) {
+				return entries
+			}
+			switch {
+			case dict[i] == '(':
+				value, end := parseLiteralString(dict, i)
+				entries[key] = decodePDFText(value)
+				i = end
+			case dict[i] == '<' && !bytes.HasPrefix(dict[i:], []byte("<<")):
+				end := bytes.IndexByte(dict[i:], '>')
+				if end < 0 {
+					return entries
+				}
+				value, _ := hex.DecodeString(string(bytes.Join(bytes.Fields(dict[i+1:i+end]), nil)))
+				entries[key] = decodePDFText(value)
+				i += end + 1
+			}
+		default:
+			i++
+		}
+	}
+	return entries
+}
+
+func isPDFSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\f' || b == 0
+}
+
+func isPDFDelimiter(b byte) bool {
+	return isPDFSpace(b) || bytes.IndexByte([]byte("()<>[]{}/%"), b) >= 0
+}
+
+// parseLiteralString reads the balanced parenthesis string starting at start, returning its bytes and the index past it.
+func parseLiteralString(content []byte, start int) ([]byte, int) {
+	var value []byte
+	depth := 0
+	for i := start; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\\' && i+1 < len(content):
+			i++
+			switch e := content[i]; e {
+			case 'n':
+				value = append(value, '\n')
+			case 'r':
+				value = append(value, '\r')
+			case 't':
+				value = append(value, '\t')
+			case 'b':
+				value = append(value, '\b')
+			case 'f':
+				value = append(value, '\f')
+			case '\r', '\n':
+				// line continuation
+				if e == '\r' && i+1 < len(content) && content[i+1] == '\n' {
+					i++
+				}
+			default:
+				if '0' <= e && e <= '7' {
+					end := i + 1
+					for end < len(content) && end < i+3 && '0' <= content[end] && content[end] <= '7' {
+						end++
+					}
+					octal, _ := strconv.ParseUint(string(content[i:end]), 8, 8)
+					value = append(value, byte(octal))
+					i = end - 1
+				} else {
+					value = append(value, e)
+				}
+			}
+		case c == '(':
+			depth++
+			if depth > 1 {
+				value = append(value, c)
+			}
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return value, i + 1
+			}
+			value = append(value, c)
+		default:
+			value = append(value, c)
+		}
+	}
+	return value, len(content)
+}
+
+// decodePDFText decodes UTF-16BE text, marked by its BOM, or else PDFDocEncoding, approximated with Latin-1.
+func decodePDFText(value []byte) string {
+	if len(value) >= 2 && value[0] == 0xfe && value[1] == 0xff {
+		units := make([]uint16, 0, len(value)/2)
+		for i := 2; i+1 < len(value); i += 2 {
+			units = append(units, uint16(value[i])<<8|uint16(value[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if len(value) >= 3 && value[0] == 0xef && value[1] == 0xbb && value[2] == 0xbf {
+		return string(value[3:])
+	}
+	runes := make([]rune, len(value))
+	for i, b := range value {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+type rdfList struct {
+	Items []string `xml:"li"`
+}
+
+type xmpDescription struct {
+	Titles      rdfList  `xml:"title>Alt"`
+	Creators    rdfList  `xml:"creator>Seq"`
+	Publishers  rdfList  `xml:"publisher>Bag"`
+	Identifiers []string `xml:"identifier"`
+	ISBN        string   `xml:"isbn"`
+	Dates       rdfList  `xml:"date>Seq"`
+}
+
+type xmpMetadata struct {
+	Title       string
+	Authors     []string
+	Publisher   string
+	Identifiers []string
+	Date        string
+}
+
+var xmpPacket = regexp.MustCompile(`(?s)<x:xmpmeta.*?</x:xmpmeta>`)
+
+/*
+pdfXMP reads the Dublin Core properties of the last uncompressed XMP packet, the one of the document if there are many,
+of the first window holding any.
+*/
+func pdfXMP(windows ...[]byte) (metadata xmpMetadata) {
+	var packets [][]byte
+	for _, w := range windows {
+		if packets = xmpPacket.FindAll(w, -1); len(packets) > 0 {
+			break
+		}
+	}
+	if len(packets) == 0 {
+		return
+	}
+	var xmp struct {
+		Descriptions []xmpDescription `xml:"RDF>Description"`
+	}
+	if err := xml.Unmarshal(packets[len(packets)-1], &xmp); err != nil {
+		return
+	}
+	for _, d := range xmp.Descriptions {
+		metadata.Title = firstNonBlank(metadata.Title, firstNonBlank(d.Titles.Items...))
+		metadata.Authors = append(metadata.Authors, nonBlank(d.Creators.Items)...)
+		metadata.Publisher = firstNonBlank(metadata.Publisher, firstNonBlank(d.Publishers.Items...))
+		metadata.Identifiers = append(metadata.Identifiers, nonBlank(append(nonEmpty(d.ISBN), d.Identifiers...))...)
+		metadata.Date = firstNonBlank(metadata.Date, firstNonBlank(d.Dates.Items...))
+	}
+	return
+}
@@ -0,0 +1,172 @@
+package main
+
+// what to do when different sources of a batch would be placed at the same path
+const (
+	disambiguateCollisions = "disambiguate"
+	refuseCollisions       = "refuse"
+)
+
+// plannedPath is where p would be placed in destination, if its clean name fits the destination file system.
+func (I *job) plannedPath(p *plannedFile, destination, cleanName string) (string, bool) {
+	name, _, err := I.fsProfileFor(destination).Adjust(cleanName, I.fsReserved)
+	if err != nil {
+		return "", false
+	}
+	return I.destinationPath(destination, p.relPath, name), true
+}
+
+/*
+resolveCollisions finds the sources that would be placed at the same path and, following the collision policy,
+either refuses the whole batch or disambiguates them: sources with identical content keep the name,
+to be linked once, the others get the first numeric suffix free in every destination.
+*/
+func (I *job) resolveCollisions(plan []*plannedFile) (refused bool) {
+	taken := map[string]bool{}
+	I.taken = taken
+	for _, p := range plan {
+		if !p.valid {
+			continue
+		}
+		for _, destination := range I.destinationDirectories {
+			if newPath, ok := I.plannedPath(p, destination, p.cleanName); ok {
+				taken[newPath] = true
+			}
+		}
+	}
+	for _, destination := range I.destinationDirectories {
+		var paths []string
+		groups := map[string][]*plannedFile{}
+		for _, p := range plan {
+			if !p.valid {
+				continue
+			}
+			if newPath, ok := I.plannedPath(p, destination, p.cleanName); ok {
+				if _, found := groups[newPath]; !found {
+					paths = append(paths, newPath)
+				}
+				groups[newPath] = append(groups[newPath], p)
+			}
+		}
+		for _, newPath := range paths {
+			group := groups[newPath]
+			if len(group) < 2 {
+				continue
+			}
+			oldPaths := make([]string, len(group))
+			for i, p := range group {
+				oldPaths[i] = p.oldPath
+			}
+			report := &group[0].events
+			if I.onCollision == refuseCollisions {
+				report.Collision(newPath, oldPaths, "refused")
+				refused = true
+				continue
+			}
+			classes := contentClasses(group, I.deps)
+			if len(classes) == 1 {
+				report.Collision(newPath, oldPaths, "identical content, linked once")
+				continue
+			}
+			for _, class := range classes[1:] {
+				cleanName := I.freeName(class[0], class[0].cleanName, taken)
+				for _, p := range class {
+					p.cleanName = cleanName
+				}
+			}
+			report.Collision(newPath, oldPaths, "suffixed")
+		}
+	}
+	if refused {
+		for _, p := range plan {
+			p.valid = false
+		}
+	}
+	return
+}
+
+/*
+planFor returns how p is planned under a name given in review: a name other than the one planned
+is first made free among the paths the batch takes, then, like any planned name, adjusted to each destination
+and placed according to the conflict policy; nothing is written.
+*/
+func (I *job) planFor(p *plannedFile) planFunc {
+	return func(cleanName string) (string, []string) {
+		if cleanName != p.cleanName {
+			cleanName = I.takeName(p, cleanName)
+			p.cleanName = cleanName
+		}
+		var newPaths []string
+		for _, destination := range I.destinationDirectories {
+			newPath, ok := I.plannedPath(p, destination, cleanName)
+			if !ok {
+				// reported once applied
+				continue
+			}
+			if placed, err := I.deps.placeFile(p.oldPath, newPath, I.onConflict, true, I.link); err == nil {
+				newPath = placed.path
+			}
+			newPaths = append(newPaths, newPath)
+		}
+		return cleanName, newPaths
+	}
+}
+
+// takeName takes the paths of cleanName, suffixing it if another source of the batch is planned at any of them.
+func (I *job) takeName(p *plannedFile, cleanName string) string {
+	var newPaths []string
+	for _, destination := range I.destinationDirectories {
+		newPath, ok := I.plannedPath(p, destination, cleanName)
+		if !ok {
+			continue
+		}
+		if I.taken[newPath] {
+			return I.freeName(p, cleanName, I.taken)
+		}
+		newPaths = append(newPaths, newPath)
+	}
+	for _, newPath := range newPaths {
+		I.taken[newPath] = true
+	}
+	return cleanName
+}
+
+// freeName returns cleanName with the first numeric suffix making its path free in every destination, and takes those paths.
+func (I *job) freeName(p *plannedFile, cleanName string, taken map[string]bool) string {
+	for n := 2; ; n++ {
+		candidate := suffixedPath(cleanName, n)
+		var newPaths []string
+		free := true
+		for _, destination := range I.destinationDirectories {
+			newPath, ok := I.plannedPath(p, destination, candidate)
+			if !ok {
+				continue
+			}
+			if taken[newPath] || I.deps.fileExists(newPath) {
+				free = false
+				break
+			}
+			newPaths = append(newPaths, newPath)
+		}
+		if free {
+			for _, newPath := range newPaths {
+				taken[newPath] = true
+			}
+			return candidate
+		}
+	}
+}
+
+// contentClasses partitions the group by content, preserving its order; unreadable files are each in a class of their own.
+func contentClasses(group []*plannedFile, deps dependencies) (classes [][]*plannedFile) {
+next:
+	for _, p := range group {
+		for i, class := range classes {
+			if same, err := deps.sameContent(class[0].oldPath, p.oldPath); err == nil && same {
+				classes[i] = append(class, p)
+				continue next
+			}
+		}
+		classes = append(classes, []*plannedFile{p})
+	}
+	return
+}
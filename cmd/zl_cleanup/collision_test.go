@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestJob builds a job through newJob, streaming its report to out, hard linking unless told otherwise, and journaling in a temporary directory.
+func newTestJob(t *testing.T, config Config, out io.Writer) *job {
+	t.Helper()
+	deps := osDependencies()
+	deps.stdout, deps.stderr = out, io.Discard
+	config.format = ndjsonFormat
+	if config.linkMode == "" {
+		config.linkMode = hardlinkMode
+	}
+	if config.journalPath == "" {
+		config.journalPath = filepath.Join(t.TempDir(), "journal.jsonl")
+	}
+	job, err := newJob(config, deps)
+	require.NoError(t, err)
+	t.Cleanup(job.close)
+	return job
+}
+
+// testDirtyFiles lists the files the job is to clean.
+func testDirtyFiles(t *testing.T, job *job) []sourceFile {
+	t.Helper()
+	files, err := dirtyFiles(job.Config, job.deps)
+	require.NoError(t, err)
+	return files
+}
+
+func cleanBatch(t *testing.T, source string, config Config) (Totals, []Event) {
+	t.Helper()
+	var out bytes.Buffer
+	config.sourceDirectory = source
+	config.rules = DefaultRuleSet()
+	job := newTestJob(t, config, &out)
+	job.removeSources(job.clean(testDirtyFiles(t, job)))
+	var events []Event
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var event Event
+		require.NoError(t, decoder.Decode(&event))
+		events = append(events, event)
+	}
+	return job.report.Totals(), events
+}
+
+func TestCollisionsDisambiguated(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"Drive (z-lib.org).pdf":     "first edition",
+		"Drive (Z-Library).pdf":     "second edition",
+		"Drive.. (z-lib.org).pdf":   "first edition",
+		"Drive (2) (z-lib.org).pdf": "taken suffix",
+	})
+	totals, events := cleanBatch(t, source, Config{
+		destinationDirectories: []string{destination},
+		onConflict:             skipOnConflict,
+		onCollision:            disambiguateCollisions,
+		doRun:                  true,
+	})
+	assert.Equal(t, 1, totals.Collisions)
+	assert.Equal(t, 4, totals.Linked+totals.Homonyms)
+	assert.Zero(t, totals.Errors)
+
+	placed := map[string]string{}
+	for _, e := range events {
+		if e.Event == "LINKED" || e.Event == "HOMONYM" {
+			placed[filepath.Base(e.Old)] = filepath.Base(e.New)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"Drive (Z-Library).pdf":     "Drive.pdf",
+		"Drive (z-lib.org).pdf":     "Drive (3).pdf",
+		"Drive.. (z-lib.org).pdf":   "Drive (3).pdf",
+		"Drive (2) (z-lib.org).pdf": "Drive (2).pdf",
+	}, placed, "sources are disambiguated in the order of their paths, skipping the suffixes taken")
+}
+
+func TestCollisionsRefused(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"Drive (z-lib.org).pdf": "first edition",
+		"Drive (Z-Library).pdf": "second edition",
+		"Other (z-lib.org).pdf": "unrelated",
+	})
+	totals, events := cleanBatch(t, source, Config{
+		destinationDirectories: []string{destination},
+		onConflict:             skipOnConflict,
+		onCollision:            refuseCollisions,
+		doRun:                  true,
+	})
+	assert.Equal(t, Totals{Collisions: 1}, totals)
+	require.Len(t, events, 1)
+	assert.Equal(t, filepath.Join(destination, "Drive.pdf"), events[0].New)
+	assert.Len(t, events[0].Sources, 2)
+	assert.NoFileExists(t, filepath.Join(destination, "Other.pdf"), "nothing is placed once the batch is refused")
+}
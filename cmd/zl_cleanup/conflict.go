@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// What to do when the clean path is already taken in a destination.
+const (
+	// keep the existing file; the source is safe to delete only if it's identical
+	skipOnConflict = "skip"
+	// link the source as "name (2).ext", "name (3).ext", ... unless an identical file is found on the way
+	suffixOnConflict = "suffix"
+	// replace an identical existing file with a link to the source, keep a different one
+	replaceIfIdenticalOnConflict = "replace-if-identical"
+	// any existing file is an error
+	failOnConflict = "fail"
+)
+
+var errConflict = errors.New("destination holds a different file")
+
+type outcome int
+
+const (
+	// the source has been (or, in dry-run, would be) linked at the path
+	placed outcome = iota
+	// the path already holds the same bytes of the source
+	duplicate
+	// the path held the same bytes of the source and now is a link to it
+	replaced
+	// the path holds a different file, kept by the skip policy: the source isn't placed
+	skipped
+)
+
+// placement is where, and how, a source ended up in a destination.
+type placement struct {
+	path string
+	outcome
+}
+
+// sameContent tells if two files hold the same bytes: either they're the same inode or they have the same size and SHA-256.
+func (I dependencies) sameContent(aPath, bPath string) (bool, error) {
+	a, err := I.stat(aPath)
+	if err != nil {
+		return false, err
+	}
+	b, err := I.stat(bPath)
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(a, b) {
+		return true, nil
+	}
+	if a.Size() != b.Size() {
+		return false, nil
+	}
+	aHash, err := I.hash(aPath)
+	if err != nil {
+		return false, err
+	}
+	bHash, err := I.hash(bPath)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aHash, bHash), nil
+}
+
+// fileHash is the SHA-256 of the file content.
+func fileHash(filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func suffixedPath(filePath string, n int) string {
+	ext := filepath.Ext(filePath)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(filePath, ext), n, ext)
+}
+
+// placeFile links oldPath at newPath with link, resolving an existing file at newPath according to policy.
+// In dry-run nothing is written and the returned placement is what would happen.
+func (I dependencies) placeFile(oldPath, newPath, policy string, dryRun bool, link linkFunc) (placement, error) {
+	candidate := newPath
+	for n := 2; ; n++ {
+		err := I.tryLink(oldPath, candidate, dryRun, link)
+		if !errors.Is(err, fs.ErrExist) {
+			return placement{candidate, placed}, err
+		}
+		if policy == failOnConflict {
+			return placement{}, &os.LinkError{Op: "link", Old: oldPath, New: candidate, Err: fs.ErrExist}
+		}
+		identical, err := I.sameContent(oldPath, candidate)
+		if err != nil {
+			return placement{}, err
+		}
+		switch {
+		case identical && policy == replaceIfIdenticalOnConflict:
+			if I.alreadyLinked(oldPath, candidate) || dryRun {
+				return placement{candidate, replaced}, nil
+			}
+			return placement{candidate, replaced}, I.replaceWithLink(oldPath, candidate, link)
+		case identical:
+			return placement{candidate, duplicate}, nil
+		case policy == suffixOnConflict:
+			candidate = suffixedPath(newPath, n)
+		case policy == skipOnConflict:
+			return placement{candidate, skipped}, nil
+		default:
+			return placement{}, &os.LinkError{Op: "link", Old: oldPath, New: candidate, Err: errConflict}
+		}
+	}
+}
+
+// tryLink links the two paths or, in dry-run, reports fs.ErrExist if the link would fail because newPath is taken.
+func (I dependencies) tryLink(oldPath, newPath string, dryRun bool, link linkFunc) error {
+	if dryRun {
+		if _, err := I.lstat(newPath); err == nil {
+			return fs.ErrExist
+		}
+		return nil
+	}
+	return link(oldPath, newPath)
+}
+
+func (I dependencies) alreadyLinked(aPath, bPath string) bool {
+	a, aErr := I.stat(aPath)
+	b, bErr := I.stat(bPath)
+	return aErr == nil && bErr == nil && os.SameFile(a, b)
+}
+
+// replaceWithLink atomically swaps filePath with a link to oldPath.
+func (I dependencies) replaceWithLink(oldPath, filePath string, link linkFunc) error {
+	tmpPath := filepath.Join(filepath.Dir(filePath), fmt.Sprintf(".%s.zl_cleanup-%d", filepath.Base(filePath), os.Getpid()))
+	if err := link(oldPath, tmpPath); err != nil {
+		return err
+	}
+	if err := I.rename(tmpPath, filePath); err != nil {
+		I.remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, contents map[string]string) {
+	for name, content := range contents {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestPlaceFile(t *testing.T) {
+	cases := []struct {
+		policy   string
+		existing string
+		expected placement
+		err      error
+	}{
+		{policy: skipOnConflict, existing: "same", expected: placement{"a.pdf", duplicate}},
+		{policy: skipOnConflict, existing: "different", expected: placement{"a.pdf", skipped}},
+		{policy: suffixOnConflict, existing: "same", expected: placement{"a.pdf", duplicate}},
+		{policy: suffixOnConflict, existing: "different", expected: placement{"a (3).pdf", placed}},
+		{policy: replaceIfIdenticalOnConflict, existing: "same", expected: placement{"a.pdf", replaced}},
+		{policy: replaceIfIdenticalOnConflict, existing: "different", err: errConflict},
+		{policy: failOnConflict, existing: "same", err: os.ErrExist},
+		{policy: failOnConflict, existing: "", expected: placement{"a.pdf", placed}},
+	}
+	for _, tc := range cases {
+		for _, dryRun := range []bool{true, false} {
+			name := tc.policy + "/" + tc.existing
+			if dryRun {
+				name += "/dry-run"
+			}
+			t.Run(name, func(t *testing.T) {
+				dir := t.TempDir()
+				writeFiles(t, dir, map[string]string{
+					"source.pdf":  "same",
+					"a (2).pdf":   "other",
+					"unrelated.x": "",
+				})
+				if tc.existing != "" {
+					writeFiles(t, dir, map[string]string{"a.pdf": tc.existing})
+				}
+				source := filepath.Join(dir, "source.pdf")
+
+				actual, err := osDependencies().placeFile(source, filepath.Join(dir, "a.pdf"), tc.policy, dryRun, os.Link)
+
+				if tc.err != nil {
+					assert.ErrorIs(t, err, tc.err)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, placement{filepath.Base(actual.path), actual.outcome})
+				linked := tc.expected.outcome != duplicate && tc.expected.outcome != skipped && !dryRun
+				assert.Equal(t, linked, osDependencies().alreadyLinked(source, actual.path))
+			})
+		}
+	}
+}
+
+func TestLinkFailureLeavesSourceUntouched(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{"Drive (z-lib.org).pdf": "drive"})
+	deps := osDependencies()
+	deps.stdout, deps.stderr = io.Discard, io.Discard
+	deps.hardlink = func(oldPath, newPath string) error {
+		return &os.LinkError{Op: "link", Old: oldPath, New: newPath, Err: syscall.EIO}
+	}
+	config := Config{
+		sourceDirectory:        source,
+		destinationDirectories: []string{destination},
+		rules:                  DefaultRuleSet(),
+		format:                 textFormat,
+		onConflict:             skipOnConflict,
+		linkMode:               hardlinkMode,
+		deleteMethod:           "delete",
+		doRun:                  true,
+		jobs:                   1,
+		journalPath:            filepath.Join(t.TempDir(), "journal.jsonl"),
+	}
+
+	assert.Equal(t, exitPartialFailure, linkToCleanPath(config, deps))
+
+	content, err := os.ReadFile(filepath.Join(source, "Drive (z-lib.org).pdf"))
+	require.NoError(t, err)
+	assert.Equal(t, "drive", string(content))
+	entries, err := os.ReadDir(destination)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestReplaceWithLinkKeepsTheFileWhenRenameFails(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"source.pdf": "same", "a.pdf": "same"})
+	deps := osDependencies()
+	deps.rename = func(oldPath, newPath string) error {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EIO}
+	}
+
+	err := deps.replaceWithLink(filepath.Join(dir, "source.pdf"), filepath.Join(dir, "a.pdf"), os.Link)
+
+	assert.ErrorIs(t, err, syscall.EIO)
+	assert.False(t, deps.alreadyLinked(filepath.Join(dir, "source.pdf"), filepath.Join(dir, "a.pdf")))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "the temporary link is removed")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"dev.acorello.it/go/arkivist/cmd/zl_cleanup/trash"
+)
+
+// appendFile is a file written at its end, like the journal, each write being made durable by Sync.
+type appendFile interface {
+	io.WriteCloser
+	Sync() error
+	Name() string
+}
+
+// dependencies are the terminal, the trash and the file system operations a job relies on; tests replace them.
+type dependencies struct {
+	stdin      io.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+	newTrasher func() (trash.Trasher, error)
+	remove     func(filePath string) error
+	removeAll  func(path string) error
+	hardlink   func(oldPath, newPath string) error
+	symlink    func(oldPath, newPath string) error
+	// reflink clones oldPath into newPath sharing its data blocks
+	reflink func(oldPath, newPath string) error
+	// copy copies oldPath into newPath, reading it back to verify it
+	copy       func(oldPath, newPath string) error
+	mkdirAll   func(dir string, perm fs.FileMode) error
+	stat       func(filePath string) (fs.FileInfo, error)
+	lstat      func(filePath string) (fs.FileInfo, error)
+	statFileID func(filePath string) (fileID, error)
+	hash       func(filePath string) ([]byte, error)
+	rename     func(oldPath, newPath string) error
+	walkDir    func(root string, fn fs.WalkDirFunc) error
+	readDir    func(dir string) ([]fs.DirEntry, error)
+	open       func(filePath string) (io.ReadCloser, error)
+	// appendTo opens filePath for appending, creating it if needed
+	appendTo  func(filePath string) (appendFile, error)
+	readFile  func(filePath string) ([]byte, error)
+	writeFile func(filePath string, content []byte, perm fs.FileMode) error
+}
+
+func osDependencies() dependencies {
+	return dependencies{
+		stdin:      os.Stdin,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		newTrasher: trash.New,
+		remove:     os.Remove,
+		removeAll:  os.RemoveAll,
+		hardlink:   os.Link,
+		symlink:    os.Symlink,
+		reflink:    reflink,
+		copy:       verifiedCopy,
+		mkdirAll:   os.MkdirAll,
+		stat:       os.Stat,
+		lstat:      os.Lstat,
+		statFileID: statFileID,
+		hash:       fileHash,
+		rename:     os.Rename,
+		walkDir:    filepath.WalkDir,
+		readDir:    os.ReadDir,
+		open: func(filePath string) (io.ReadCloser, error) {
+			// not returned as is, for a nil *os.File not to be a non-nil io.ReadCloser
+			f, err := os.Open(filePath)
+			if err != nil {
+				return nil, err
+			}
+			return f, nil
+		},
+		appendTo: func(filePath string) (appendFile, error) {
+			f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if err != nil {
+				return nil, err
+			}
+			return f, nil
+		},
+		readFile:  os.ReadFile,
+		writeFile: os.WriteFile,
+	}
+}
+
+func (I dependencies) fileExists(filePath string) bool {
+	_, err := I.stat(filePath)
+	return !os.IsNotExist(err)
+}
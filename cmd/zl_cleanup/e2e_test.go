@@ -0,0 +1,289 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dev.acorello.it/go/arkivist/cmd/zl_cleanup/trash"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the end-to-end tests")
+
+// movingTrasher trashes files by moving them into dir.
+type movingTrasher struct {
+	dir string
+}
+
+func (I movingTrasher) Trash(filePaths ...string) error {
+	if err := os.MkdirAll(I.dir, 0o755); err != nil {
+		return err
+	}
+	for _, filePath := range filePaths {
+		if err := os.Rename(filePath, filepath.Join(I.dir, filepath.Base(filePath))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+e2eCase is a fixture tree, relative to a root holding the "src" and "dst" directories,
+and the changes to the default configuration; its golden file records the exit code,
+the rendered report and the resulting tree.
+With betweenPlanAndApply, the configuration is planned, the tree changed, and the plan applied skipping what drifted.
+*/
+type e2eCase struct {
+	name                string
+	files               map[string]string
+	configure           func(*Config)
+	betweenPlanAndApply func(root string)
+}
+
+var e2eCases = []e2eCase{
+	{
+		name: "dry-run",
+		files: map[string]string{
+			"src/Drive (z-lib.org).pdf":           "drive",
+			"src/Programming Go (Z-Library).epub": "go",
+			"src/notes.txt":                       "notes",
+		},
+	},
+	{
+		name: "run-trash",
+		files: map[string]string{
+			"src/Drive (z-lib.org).pdf":           "drive",
+			"src/Programming Go (Z-Library).epub": "go",
+			"src/notes.txt":                       "notes",
+		},
+		configure: func(c *Config) {
+			c.doRun = true
+			c.deleteMethod = "trash"
+		},
+	},
+	{
+		name: "run-delete-conflicts",
+		files: map[string]string{
+			"src/Drive (z-lib.org).pdf": "drive",
+			"src/Flow (z-lib.org).pdf":  "flow",
+			"dst/Drive.pdf":             "another drive",
+			"dst/Flow.pdf":              "flow",
+		},
+		configure: func(c *Config) {
+			c.doRun = true
+			c.deleteMethod = "delete"
+			c.onConflict = suffixOnConflict
+		},
+	},
+	{
+		name: "run-skip-conflicts",
+		files: map[string]string{
+			"src/Drive (z-lib.org).pdf": "drive",
+			"src/Flow (z-lib.org).pdf":  "flow",
+			"dst/Drive.pdf":             "another drive",
+		},
+		configure: func(c *Config) {
+			c.doRun = true
+			c.deleteMethod = "delete"
+		},
+	},
+	{
+		name: "run-skip-duplicates",
+		files: map[string]string{
+			"src/Drive, 2nd copy (z-lib.org).pdf": "drive",
+			"src/Flow (z-lib.org).pdf":            "flow",
+			"src/Flow, again (z-lib.org).pdf":     "flow",
+			"dst/business/Drive.pdf":              "drive",
+		},
+		configure: func(c *Config) {
+			c.doRun = true
+			c.deleteMethod = "trash"
+			c.skipDuplicates = true
+		},
+	},
+	{
+		name: "run-normalize",
+		files: map[string]string{
+			"src/A Beginner’s Guide (z-lib.org).pdf": "guide",
+			"src/Grønbæk Cafe\u0301 (z-lib.org).pdf": "cafe",
+		},
+		configure: func(c *Config) {
+			c.doRun = true
+			if err := c.rules.normalizeWith("NFC,fold-quotes,transliterate"); err != nil {
+				panic(err)
+			}
+		},
+	},
+	{
+		name: "plan-apply-kept-copy-changed",
+		files: map[string]string{
+			"src/Drive (z-lib.org).pdf": "drive",
+			"src/Flow (z-lib.org).pdf":  "flow",
+			"src/Go (z-lib.org).epub":   "go",
+			"dst/Flow.pdf":              "flow",
+			"dst/Go.epub":               "go",
+		},
+		configure: func(c *Config) {
+			c.deleteMethod = "trash"
+		},
+		betweenPlanAndApply: func(root string) {
+			if err := os.Remove(filepath.Join(root, "dst", "Flow.pdf")); err != nil {
+				panic(err)
+			}
+			if err := os.WriteFile(filepath.Join(root, "dst", "Go.epub"), []byte("edited go"), 0o644); err != nil {
+				panic(err)
+			}
+		},
+	},
+	{
+		name: "plan-apply-replace",
+		files: map[string]string{
+			"src/Drive (z-lib.org).pdf": "drive",
+			"src/Flow (z-lib.org).pdf":  "flow",
+			"dst/Drive.pdf":             "drive",
+			"dst/Flow.pdf":              "flow",
+		},
+		configure: func(c *Config) {
+			c.deleteMethod = "trash"
+			c.onConflict = replaceIfIdenticalOnConflict
+		},
+		betweenPlanAndApply: func(root string) {
+			if err := os.WriteFile(filepath.Join(root, "dst", "Drive.pdf"), []byte("edited drive"), 0o644); err != nil {
+				panic(err)
+			}
+		},
+	},
+	{
+		name: "recursive-collision",
+		files: map[string]string{
+			"src/a/Drive (z-lib.org).pdf": "first edition",
+			"src/b/Drive (z-lib.org).pdf": "second edition",
+		},
+		configure: func(c *Config) {
+			c.doRun = true
+			c.recursive = true
+			c.flatten = true
+		},
+	},
+}
+
+func TestEndToEnd(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+	for _, c := range e2eCases {
+		t.Run(c.name, func(t *testing.T) {
+			got := runE2E(t, c)
+			golden := filepath.Join("testdata", "e2e", c.name+".golden")
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(golden, []byte(got), 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err, "run 'go test -run TestEndToEnd -update' to create the golden file")
+			assert.Equal(t, string(expected), got)
+		})
+	}
+}
+
+func runE2E(t *testing.T, c e2eCase) string {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "src"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "dst"), 0o755))
+	writeFiles(t, root, c.files)
+	config := Config{
+		sourceDirectory:        filepath.Join(root, "src"),
+		destinationDirectories: []string{filepath.Join(root, "dst")},
+		rules:                  DefaultRuleSet(),
+		format:                 textFormat,
+		onConflict:             skipOnConflict,
+		onCollision:            disambiguateCollisions,
+		linkMode:               hardlinkMode,
+		fsReserved:             replaceReserved,
+		fsProfiles:             map[string]string{filepath.Join(root, "dst"): "ext4"},
+		jobs:                   1,
+		journalPath:            filepath.Join(t.TempDir(), "journal.jsonl"),
+	}
+	if c.configure != nil {
+		c.configure(&config)
+	}
+	var stdout, stderr bytes.Buffer
+	deps := osDependencies()
+	deps.stdin, deps.stdout, deps.stderr = strings.NewReader(""), &stdout, &stderr
+	deps.newTrasher = func() (trash.Trasher, error) {
+		return movingTrasher{filepath.Join(root, "trash")}, nil
+	}
+	var code int
+	if c.betweenPlanAndApply == nil {
+		code = linkToCleanPath(config, deps)
+	} else {
+		code = planAndApply(t, root, config, deps, c.betweenPlanAndApply)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "exit: %d\n-- stdout --\n%s-- stderr --\n%s-- tree --\n", code, stdout.String(), stderr.String())
+	sb.WriteString(renderTree(t, root))
+	return strings.ReplaceAll(sb.String(), root, "$ROOT")
+}
+
+// planAndApply plans a dry run of config, lets change the tree under root, then applies the plan skipping what drifted.
+func planAndApply(t *testing.T, root string, config Config, deps dependencies, change func(root string)) int {
+	config.doRun = false
+	plan, _, _, errs, err := makePlan(config, deps)
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	change(root)
+	journal, err := OpenJournal(config.journalPath, deps)
+	require.NoError(t, err)
+	defer journal.Close()
+	report := NewReporter(Config{doRun: true, format: textFormat}, deps.stdout, deps.stderr)
+	aborted := applyPlan(plan, skipOnDrift, report, journal, deps)
+	report.Print()
+	return exitCode(report.Totals(), aborted)
+}
+
+// renderTree lists the files under root with their content; files sharing an inode share the same #label.
+func renderTree(t *testing.T, root string) string {
+	var sb strings.Builder
+	labels := map[fileID]int{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		relPath, _ := filepath.Rel(root, path)
+		if d.IsDir() {
+			fmt.Fprintf(&sb, "%s/\n", relPath)
+			return nil
+		}
+		if d.Name() == libraryIndexName {
+			// holds inode numbers, changing at every run
+			fmt.Fprintf(&sb, "%s\n", relPath)
+			return nil
+		}
+		id, err := statFileID(path)
+		if err != nil {
+			return err
+		}
+		if _, found := labels[id]; !found {
+			labels[id] = len(labels) + 1
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sb, "%s #%d %q\n", relPath, labels[id], content)
+		return nil
+	})
+	require.NoError(t, err)
+	return sb.String()
+}
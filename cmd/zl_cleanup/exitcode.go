@@ -0,0 +1,32 @@
+package main
+
+/*
+Exit codes, meant for cron and pipelines:
+
+	0 success: every file was cleaned, or previewed
+	1 partial failure: some operation failed
+	2 config error: nothing was attempted
+	3 nothing to do: no dirty file was found
+	4 aborted: 'max-errors' was reached, or the batch was refused, before completion
+*/
+const (
+	exitSuccess        = 0
+	exitPartialFailure = 1
+	exitConfigError    = 2
+	exitNothingToDo    = 3
+	exitAborted        = 4
+)
+
+// exitCode tells how a run went from its report totals.
+func exitCode(totals Totals, aborted bool) int {
+	switch {
+	case aborted:
+		return exitAborted
+	case totals.Errors > 0:
+		return exitPartialFailure
+	case totals == Totals{}:
+		return exitNothingToDo
+	default:
+		return exitSuccess
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitNothingToDo, exitCode(Totals{}, false))
+	assert.Equal(t, exitSuccess, exitCode(Totals{Sources: 1, Linked: 1}, false))
+	assert.Equal(t, exitPartialFailure, exitCode(Totals{Sources: 2, Linked: 1, Errors: 1}, false))
+	assert.Equal(t, exitPartialFailure, exitCode(Totals{Errors: 1}, false), "a name that can't be cleaned is a failure")
+	assert.Equal(t, exitAborted, exitCode(Totals{Sources: 1, Errors: 3}, true))
+}
+
+func TestMaxErrors(t *testing.T) {
+	for _, jobs := range []int{1, 3} {
+		source, destination := t.TempDir(), t.TempDir()
+		sources, taken := map[string]string{}, map[string]string{}
+		for i := 0; i < 20; i++ {
+			sources[fmt.Sprintf("%02d (z-lib.org).pdf", i)] = "new"
+			taken[fmt.Sprintf("%02d.pdf", i)] = "old"
+		}
+		writeFiles(t, source, sources)
+		writeFiles(t, destination, taken)
+		job := newTestJob(t, Config{
+			sourceDirectory:        source,
+			destinationDirectories: []string{destination},
+			rules:                  DefaultRuleSet(),
+			onConflict:             failOnConflict,
+			deleteMethod:           "delete",
+			doRun:                  true,
+			jobs:                   jobs,
+			maxErrors:              2,
+		}, io.Discard)
+		job.removeSources(job.clean(testDirtyFiles(t, job)))
+		errors := job.report.Totals().Errors
+		assert.True(t, job.aborted)
+		assert.GreaterOrEqual(t, errors, 2)
+		assert.Less(t, errors, 20, "jobs: %d", jobs)
+		if jobs == 1 {
+			assert.Equal(t, 2, errors)
+		}
+	}
+}
+
+func TestNoDeleteMethodIsNotFatal(t *testing.T) {
+	source := t.TempDir()
+	writeFiles(t, source, map[string]string{"a (z-lib.org).pdf": "a"})
+	_, events := cleanBatch(t, source, Config{destinationDirectories: []string{source}, onConflict: skipOnConflict})
+	assert.Equal(t, "LINK_PREVIEW", events[len(events)-1].Event)
+}
+
+func TestUnopenableJournalIsAConfigError(t *testing.T) {
+	source := t.TempDir()
+	writeFiles(t, source, map[string]string{"a (z-lib.org).pdf": "a", "taken": ""})
+	deps := osDependencies()
+	deps.stdout, deps.stderr = io.Discard, io.Discard
+	config := Config{
+		sourceDirectory:        source,
+		destinationDirectories: []string{t.TempDir()},
+		rules:                  DefaultRuleSet(),
+		linkMode:               hardlinkMode,
+		doRun:                  true,
+		journalPath:            filepath.Join(source, "taken", "journal.jsonl"),
+	}
+
+	assert.Equal(t, exitConfigError, linkToCleanPath(config, deps))
+	assert.FileExists(t, filepath.Join(source, "a (z-lib.org).pdf"), "nothing is attempted")
+}
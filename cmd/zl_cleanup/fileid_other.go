@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func statFileID(path string) (fileID, error) {
+	return fileID{}, errors.New("inodes not supported on this platform")
+}
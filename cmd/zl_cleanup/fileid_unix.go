@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// statFileID identifies the file at path, hard links to the same file share the same fileID.
+func statFileID(path string) (fileID, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileID{}, err
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	return fileID{Device: uint64(stat.Dev), Inode: uint64(stat.Ino)}, nil
+}
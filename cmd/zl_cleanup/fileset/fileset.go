@@ -1,5 +1,7 @@
 package fileset
 
+import "sort"
+
 type FileSet map[string]struct{}
 
 func New() FileSet {
@@ -19,3 +21,13 @@ func (I *FileSet) Remove(filename string) {
 func (I FileSet) IsEmpty() bool {
 	return len(I) == 0
 }
+
+// Sorted returns the file names in lexical order.
+func (I FileSet) Sorted() []string {
+	fileNames := make([]string, 0, len(I))
+	for fileName := range I {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	return fileNames
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// FSProfile describes the filenames a destination file system accepts.
+type FSProfile struct {
+	Name string
+	// MaxLength of a filename, measured with lengthOf
+	MaxLength int
+	lengthOf  func(string) int
+	// Reserved characters and what they should be replaced with
+	Reserved map[rune]string
+	// ReservedNames can't be used as the part of a filename before the first dot, whatever follows
+	ReservedNames []string
+	// NoTrailing characters are silently dropped from the end of a name
+	NoTrailing string
+	// NoHardLinks is set for file systems that can't hard link, failing with EPERM
+	NoHardLinks bool
+}
+
+func byteLength(s string) int {
+	return len(s)
+}
+
+func utf16Length(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+var windowsReserved = map[rune]string{
+	'<': "(", '>': ")", ':': "-", '"': "'", '/': "-", '\\': "-", '|': "-", '?': "", '*': "",
+}
+
+var windowsReservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+var fsProfiles = map[string]FSProfile{
+	"ext4": {
+		Name:      "ext4",
+		MaxLength: 255,
+		lengthOf:  byteLength,
+		Reserved:  map[rune]string{'/': "-"},
+	},
+	"exfat": {
+		Name:          "exfat",
+		MaxLength:     255,
+		lengthOf:      utf16Length,
+		Reserved:      windowsReserved,
+		ReservedNames: windowsReservedNames,
+		NoTrailing:    ". ",
+		NoHardLinks:   true,
+	},
+	"fat": {
+		Name:          "fat",
+		MaxLength:     255,
+		lengthOf:      utf16Length,
+		Reserved:      windowsReserved,
+		ReservedNames: windowsReservedNames,
+		NoTrailing:    ". ",
+		NoHardLinks:   true,
+	},
+	"smb": {
+		Name:          "smb",
+		MaxLength:     255,
+		lengthOf:      utf16Length,
+		Reserved:      windowsReserved,
+		ReservedNames: windowsReservedNames,
+		NoTrailing:    ". ",
+		NoHardLinks:   true,
+	},
+	"macos": {
+		Name:      "macos",
+		MaxLength: 255,
+		lengthOf:  utf16Length,
+		Reserved:  map[rune]string{'/': "-", ':': "-"},
+	},
+}
+
+// How to deal with reserved characters and names.
+const (
+	replaceReserved = "replace"
+	rejectReserved  = "reject"
+)
+
+var errReservedName = errors.New("name not allowed by the destination file system")
+
+// isbnPrefix matches an ISBN-10 or ISBN-13 at the start of a name, along with the separator following it
+var isbnPrefix = regexp.MustCompile(`^(?:97[89]-?)?(?:\d-?){9}[\dXx](?:\s*•\s*|\s*-\s*|\s+)?`)
+
+// Adjust makes fileName acceptable by the file system, returning a description of each adjustment made.
+// With the reject policy a reserved character or name is an error instead.
+func (I FSProfile) Adjust(fileName, policy string) (adjusted string, adjustments []string, err error) {
+	adjusted = fileName
+	if replaced := I.replaceReserved(adjusted); replaced != adjusted {
+		if policy == rejectReserved {
+			return fileName, nil, fmt.Errorf("%w: reserved characters in %q on %s", errReservedName, fileName, I.Name)
+		}
+		adjustments = append(adjustments, fmt.Sprintf("replaced characters reserved on %s", I.Name))
+		adjusted = replaced
+	}
+	if trimmed := I.trimTrailing(adjusted); trimmed != adjusted {
+		adjustments = append(adjustments, fmt.Sprintf("removed trailing %q not allowed on %s", I.NoTrailing, I.Name))
+		adjusted = trimmed
+	}
+	if stem := reservedStem(adjusted); I.isReservedName(stem) {
+		if policy == rejectReserved {
+			return fileName, nil, fmt.Errorf("%w: %q is reserved on %s", errReservedName, stem, I.Name)
+		}
+		adjustments = append(adjustments, fmt.Sprintf("%q is a name reserved on %s", stem, I.Name))
+		adjusted = stem + "_" + adjusted[len(stem):]
+	}
+	if I.lengthOf(adjusted) > I.MaxLength {
+		truncated := I.truncate(adjusted)
+		adjustments = append(adjustments, fmt.Sprintf("truncated from %d to %d, the maximum on %s", I.lengthOf(adjusted), I.lengthOf(truncated), I.Name))
+		adjusted = truncated
+	}
+	return adjusted, adjustments, nil
+}
+
+func (I FSProfile) replaceReserved(fileName string) string {
+	var sb strings.Builder
+	for _, r := range fileName {
+		if replacement, reserved := I.Reserved[r]; reserved {
+			sb.WriteString(replacement)
+		} else if r < 0x20 && I.NoTrailing != "" {
+			// control characters aren't allowed on Windows file systems
+			continue
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func (I FSProfile) trimTrailing(fileName string) string {
+	if I.NoTrailing == "" {
+		return fileName
+	}
+	return strings.TrimRight(fileName, I.NoTrailing)
+}
+
+// reservedStem is the part of the name checked against the reserved names: Windows ignores anything from the first dot, and the spaces before it.
+func reservedStem(fileName string) string {
+	stem, _, _ := strings.Cut(fileName, ".")
+	return strings.TrimRight(stem, " ")
+}
+
+func (I FSProfile) isReservedName(stem string) bool {
+	for _, name := range I.ReservedNames {
+		if strings.EqualFold(stem, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate shortens the title, preferably at a word boundary, keeping the extension and a leading ISBN.
+func (I FSProfile) truncate(fileName string) string {
+	const maxWordLength = 20
+	ext := filepath.Ext(fileName)
+	title := strings.TrimSuffix(fileName, ext)
+	prefix := isbnPrefix.FindString(title)
+	runes := []rune(strings.TrimPrefix(title, prefix))
+	cut := len(runes)
+	for cut > 0 && I.lengthOf(prefix+string(runes[:cut])+ext) > I.MaxLength {
+		cut--
+	}
+	if cut < len(runes) && runes[cut] != ' ' {
+		for i := cut - 1; i >= 0 && cut-i <= maxWordLength; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+	}
+	return strings.TrimRight(prefix+strings.TrimRight(string(runes[:cut]), " •-_,;."), " ") + ext
+}
+
+// fsProfileFlag maps destination directories to the name of their file system profile, as given with `-fs DIR=PROFILE`.
+type fsProfileFlag map[string]string
+
+func (me *fsProfileFlag) String() string {
+	if me == nil {
+		return ""
+	}
+	var pairs []string
+	for dir, profile := range *me {
+		pairs = append(pairs, dir+"="+profile)
+	}
+	return strings.Join(pairs, " ")
+}
+
+func (me *fsProfileFlag) Set(value string) error {
+	dir, profile, found := strings.Cut(value, "=")
+	if !found {
+		return fmt.Errorf("expected DIR=PROFILE, got %q", value)
+	}
+	if _, known := fsProfiles[profile]; !known {
+		return fmt.Errorf("unknown file system profile %q", profile)
+	}
+	absDir, err := filepath.Abs(strings.TrimSpace(dir))
+	if err != nil {
+		return err
+	}
+	(*me)[absDir] = profile
+	return nil
+}
+
+// fsProfileFor returns the profile given for destination, or the one of the file system it's on.
+func (I Config) fsProfileFor(destination string) FSProfile {
+	if name, found := I.fsProfiles[destination]; found {
+		return fsProfiles[name]
+	}
+	if name := detectFSProfile(destination); name != "" {
+		return fsProfiles[name]
+	}
+	return fsProfiles["ext4"]
+}
@@ -0,0 +1,23 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// detectFSProfile recognizes, from the file system type, the profile of dir.
+func detectFSProfile(dir string) string {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return ""
+	}
+	switch uint32(stat.Type) {
+	case unix.EXT4_SUPER_MAGIC, unix.BTRFS_SUPER_MAGIC, unix.XFS_SUPER_MAGIC, unix.TMPFS_MAGIC:
+		return "ext4"
+	case unix.MSDOS_SUPER_MAGIC:
+		return "fat"
+	case 0x2011bab0: // exFAT
+		return "exfat"
+	case unix.SMB_SUPER_MAGIC, unix.SMB2_SUPER_MAGIC, unix.CIFS_SUPER_MAGIC:
+		return "smb"
+	default:
+		return ""
+	}
+}
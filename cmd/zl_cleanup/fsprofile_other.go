@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "runtime"
+
+func detectFSProfile(dir string) string {
+	if runtime.GOOS == "darwin" {
+		return "macos"
+	}
+	return ""
+}
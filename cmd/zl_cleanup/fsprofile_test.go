@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSProfileAdjust(t *testing.T) {
+	longTitle := strings.Repeat("Structure and Interpretations ", 10)
+	cases := []struct {
+		profile     string
+		name        string
+		adjusted    string
+		adjustments int
+	}{
+		{profile: "ext4", name: "Go: The Way?.pdf", adjusted: "Go: The Way?.pdf"},
+		{profile: "smb", name: "Go: The Way?.pdf", adjusted: "Go- The Way.pdf", adjustments: 1},
+		{profile: "exfat", name: "<Draft> notes. ", adjusted: "(Draft) notes", adjustments: 2},
+		{profile: "fat", name: "con.txt", adjusted: "con_.txt", adjustments: 1},
+		{profile: "exfat", name: "CON.tar.gz", adjusted: "CON_.tar.gz", adjustments: 1},
+		{profile: "smb", name: "nul.2023.backup.pdf", adjusted: "nul_.2023.backup.pdf", adjustments: 1},
+		{profile: "smb", name: "AUX .pdf", adjusted: "AUX_ .pdf", adjustments: 1},
+		{profile: "fat", name: "PRN.", adjusted: "PRN_", adjustments: 2},
+		{profile: "fat", name: "LPT1 . ", adjusted: "LPT1_", adjustments: 2},
+		{profile: "smb", name: "CONSOLE.tar.gz", adjusted: "CONSOLE.tar.gz"},
+		{profile: "smb", name: "Notes.CON.pdf", adjusted: "Notes.CON.pdf"},
+		{profile: "ext4", name: "CON.tar.gz", adjusted: "CON.tar.gz"},
+		{profile: "macos", name: "Go: The Way?.pdf", adjusted: "Go- The Way?.pdf", adjustments: 1},
+		{
+			profile:     "ext4",
+			name:        "9781101152140 • " + longTitle + "• by Daniel H. Pink.epub",
+			adjusted:    "9781101152140 • " + strings.Repeat("Structure and Interpretations ", 7) + "Structure and.epub",
+			adjustments: 1,
+		},
+	}
+	for n, tc := range cases {
+		t.Run(fmt.Sprintf("%0.2d:%s:%q", n, tc.profile, tc.name), func(t *testing.T) {
+			profile := fsProfiles[tc.profile]
+			adjusted, adjustments, err := profile.Adjust(tc.name, replaceReserved)
+			require.NoError(t, err)
+			assert.Equal(t, tc.adjusted, adjusted)
+			assert.Len(t, adjustments, tc.adjustments)
+			assert.LessOrEqual(t, profile.lengthOf(adjusted), profile.MaxLength)
+		})
+	}
+}
+
+func TestFSProfileTruncatesUTF16(t *testing.T) {
+	profile := fsProfiles["exfat"]
+	name := strings.Repeat("😀", 200) + ".pdf"
+	adjusted, _, err := profile.Adjust(name, replaceReserved)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("😀", 125)+".pdf", adjusted)
+}
+
+func TestFSProfileRejects(t *testing.T) {
+	_, _, err := fsProfiles["smb"].Adjust("Go: The Way.pdf", rejectReserved)
+	assert.ErrorIs(t, err, errReservedName)
+	_, _, err = fsProfiles["smb"].Adjust("AUX.pdf", rejectReserved)
+	assert.ErrorIs(t, err, errReservedName)
+	_, _, err = fsProfiles["exfat"].Adjust("CON.tar.gz", rejectReserved)
+	assert.ErrorIs(t, err, errReservedName)
+}
+
+func TestFSProfileFlag(t *testing.T) {
+	profiles := fsProfileFlag{}
+	require.NoError(t, profiles.Set("/mnt/nas=smb"))
+	assert.Error(t, profiles.Set("/mnt/nas"))
+	assert.Error(t, profiles.Set("/mnt/nas=ntfs"))
+	config := Config{fsProfiles: profiles}
+	assert.Equal(t, "smb", config.fsProfileFor("/mnt/nas").Name)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type fileID struct {
+	Device uint64 `json:"device"`
+	Inode  uint64 `json:"inode"`
+}
+
+const (
+	linkOp = "link"
+	// keptOp records a file, not created by the run, already holding the content of the source: undo restores from it, but never removes it
+	keptOp = "kept"
+	// the other operations are the delete methods: "trash" and "delete"
+)
+
+// JournalEntry is a single line of the journal, recording one operation on the file system.
+type JournalEntry struct {
+	Time        time.Time `json:"time"`
+	Op          string    `json:"op"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination,omitempty"`
+	fileID
+}
+
+// Journal records, as JSON lines appended while they happen, the links created and the sources removed by a run so that `undo` can revert them.
+type Journal struct {
+	// mutex serializes the entries appended by concurrent workers
+	mutex      sync.Mutex
+	file       appendFile
+	encoder    *json.Encoder
+	now        func() time.Time
+	statFileID func(filePath string) (fileID, error)
+}
+
+// defaultJournalPath is $XDG_STATE_HOME/zl_cleanup/<timestamp>.jsonl, ~/.local/state being used when the variable is not set.
+func defaultJournalPath(now time.Time) (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "zl_cleanup", now.Format("20060102T150405.000000000")+".jsonl"), nil
+}
+
+func OpenJournal(filePath string, deps dependencies) (*Journal, error) {
+	if err := deps.mkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := deps.appendTo(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{file: f, encoder: json.NewEncoder(f), now: time.Now, statFileID: deps.statFileID}, nil
+}
+
+func (I *Journal) append(entry JournalEntry) error {
+	if I == nil {
+		return nil
+	}
+	I.mutex.Lock()
+	defer I.mutex.Unlock()
+	entry.Time = I.now()
+	if err := I.encoder.Encode(entry); err != nil {
+		return fmt.Errorf("writing journal %q: %w", I.file.Name(), err)
+	}
+	return I.file.Sync()
+}
+
+// Linked records a link just created from source to destination.
+func (I *Journal) Linked(source, destination string) error {
+	if I == nil {
+		return nil
+	}
+	id, err := I.statFileID(destination)
+	if err != nil {
+		return err
+	}
+	return I.append(JournalEntry{Op: linkOp, Source: source, Destination: destination, fileID: id})
+}
+
+// Kept records destination already held the content of source, making its removal safe.
+func (I *Journal) Kept(source, destination string) error {
+	if I == nil {
+		return nil
+	}
+	id, err := I.statFileID(destination)
+	if err != nil {
+		return err
+	}
+	return I.append(JournalEntry{Op: keptOp, Source: source, Destination: destination, fileID: id})
+}
+
+// Removed records the source, identified before removal, was removed with deleteMethod.
+func (I *Journal) Removed(source, deleteMethod string, id fileID) error {
+	return I.append(JournalEntry{Op: deleteMethod, Source: source, fileID: id})
+}
+
+func (I *Journal) Close() error {
+	if I == nil {
+		return nil
+	}
+	return I.file.Close()
+}
+
+func ReadJournal(filePath string, deps dependencies) (entries []JournalEntry, err error) {
+	f, err := deps.open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filePath, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
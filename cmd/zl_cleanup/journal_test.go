@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a (z-lib.org).pdf")
+	destination := filepath.Join(dir, "a.pdf")
+	require.NoError(t, os.WriteFile(source, []byte("a"), 0o644))
+	require.NoError(t, os.Link(source, destination))
+	id, err := statFileID(source)
+	require.NoError(t, err)
+
+	journalPath := filepath.Join(dir, "state", "run.jsonl")
+	journal, err := OpenJournal(journalPath, osDependencies())
+	require.NoError(t, err)
+	require.NoError(t, journal.Linked(source, destination))
+	require.NoError(t, journal.Removed(source, "delete", id))
+	require.NoError(t, journal.Close())
+
+	entries, err := ReadJournal(journalPath, osDependencies())
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, JournalEntry{Time: entries[0].Time, Op: linkOp, Source: source, Destination: destination, fileID: id}, entries[0])
+	assert.Equal(t, JournalEntry{Time: entries[1].Time, Op: "delete", Source: source, fileID: id}, entries[1])
+}
+
+func TestUndoSource(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a (z-lib.org).pdf")
+	kept := filepath.Join(dir, "kept.pdf")
+	replaced := filepath.Join(dir, "replaced.pdf")
+	require.NoError(t, os.WriteFile(source, []byte("a"), 0o644))
+	require.NoError(t, os.Link(source, kept))
+	require.NoError(t, os.Link(source, replaced))
+	id, err := statFileID(source)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(source))
+	// somebody replaced one of the links with a different file
+	require.NoError(t, os.Remove(replaced))
+	require.NoError(t, os.WriteFile(replaced, []byte("b"), 0o644))
+
+	journaled := &journaledSource{
+		path: source,
+		links: []JournalEntry{
+			{Op: linkOp, Source: source, Destination: replaced, fileID: id},
+			{Op: linkOp, Source: source, Destination: kept, fileID: id},
+		},
+		removal: &JournalEntry{Op: "trash", Source: source, fileID: id},
+	}
+
+	report := NewSummary(Config{})
+	undoSource(journaled, true, &report, osDependencies())
+	assert.NoFileExists(t, source, "dry run should not touch the file system")
+
+	report = NewSummary(Config{doRun: true})
+	undoSource(journaled, false, &report, osDependencies())
+
+	assert.True(t, osDependencies().sameFile(source, id))
+	assert.NoFileExists(t, kept)
+	assert.FileExists(t, replaced, "a link that is not the journaled inode anymore must be left alone")
+	assert.Contains(t, report.err.String(), "replaced.pdf")
+}
+
+func TestUndoRestoresFromKeptCopies(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{"Flow (z-lib.org).pdf": "flow"})
+	writeFiles(t, destination, map[string]string{"Flow.pdf": "flow"})
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	deps := osDependencies()
+	deps.stdout, deps.stderr = io.Discard, io.Discard
+	config := Config{
+		sourceDirectory:        source,
+		destinationDirectories: []string{destination},
+		rules:                  DefaultRuleSet(),
+		onConflict:             skipOnConflict,
+		linkMode:               hardlinkMode,
+		deleteMethod:           "delete",
+		doRun:                  true,
+		jobs:                   1,
+		journalPath:            journalPath,
+	}
+	require.Equal(t, exitSuccess, linkToCleanPath(config, deps))
+	require.NoFileExists(t, filepath.Join(source, "Flow (z-lib.org).pdf"))
+
+	entries, err := ReadJournal(journalPath, osDependencies())
+	require.NoError(t, err)
+	report := NewSummary(Config{doRun: true})
+	for _, journaled := range groupBySource(entries) {
+		undoSource(journaled, false, &report, osDependencies())
+	}
+
+	assert.Empty(t, report.err.String())
+	assert.True(t, osDependencies().identical(filepath.Join(source, "Flow (z-lib.org).pdf"), filepath.Join(destination, "Flow.pdf")))
+	assert.FileExists(t, filepath.Join(destination, "Flow.pdf"), "a file the run didn't create is never unlinked")
+}
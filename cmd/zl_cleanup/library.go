@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// libraryIndexName is the sidecar file, at the root of a destination, caching the hashes of its files.
+const libraryIndexName = ".zl_cleanup-index.json"
+
+// contentKey identifies a content regardless of the name it has.
+type contentKey struct {
+	size int64
+	hash string
+}
+
+// indexedFile is a cached hash, valid as long as the file keeps its inode and modification time.
+type indexedFile struct {
+	fileID
+	ModTime int64  `json:"mtime"`
+	Size    int64  `json:"size"`
+	Hash    string `json:"sha256"`
+}
+
+type cacheKey struct {
+	fileID
+	modTime int64
+}
+
+/*
+LibraryIndex maps the content of every file in a destination, dirty ones aside, to its path.
+
+Hashes are cached in the sidecar file, keyed by inode and modification time, so that only the files
+added or changed since the last run are read; without a cache, the index hashes every file in the destination.
+*/
+type LibraryIndex struct {
+	mutex sync.Mutex
+	paths map[contentKey]string
+	sizes map[int64]bool
+	cache []indexedFile
+	deps  dependencies
+}
+
+// BuildLibraryIndex walks the destination, hashing the files it can't find in the cache, which is updated unless it's a dry run.
+func BuildLibraryIndex(destination string, rules RuleSet, dryRun bool, deps dependencies) (*LibraryIndex, error) {
+	cachePath := filepath.Join(destination, libraryIndexName)
+	cached := map[cacheKey]indexedFile{}
+	if content, err := deps.readFile(cachePath); err == nil {
+		var files []indexedFile
+		// a corrupted cache is just rebuilt
+		if json.Unmarshal(content, &files) == nil {
+			for _, f := range files {
+				cached[cacheKey{f.fileID, f.ModTime}] = f
+			}
+		}
+	}
+	index := &LibraryIndex{paths: map[contentKey]string{}, sizes: map[int64]bool{}, deps: deps}
+	err := deps.walkDir(destination, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || path == cachePath || rules.IsDirty(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		id, idErr := deps.statFileID(path)
+		key := cacheKey{id, info.ModTime().UnixNano()}
+		f, found := cached[key]
+		if !found || idErr != nil || f.Size != info.Size() {
+			hash, err := deps.hash(path)
+			if err != nil {
+				return err
+			}
+			f = indexedFile{fileID: id, ModTime: key.modTime, Size: info.Size(), Hash: hex.EncodeToString(hash)}
+		}
+		if idErr == nil {
+			index.cache = append(index.cache, f)
+		}
+		index.add(path, contentKey{f.Size, f.Hash})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return index, nil
+	}
+	content, err := json.Marshal(index.cache)
+	if err != nil {
+		return index, err
+	}
+	return index, deps.writeFile(cachePath, content, 0o644)
+}
+
+func (I *LibraryIndex) add(path string, key contentKey) {
+	// the walk is in lexical order: the first path found for a content is kept
+	if _, found := I.paths[key]; !found {
+		I.paths[key] = path
+	}
+	I.sizes[key.size] = true
+}
+
+// Find returns where the library already holds the content of filePath, if anywhere but at filePath itself.
+func (I *LibraryIndex) Find(filePath string) (string, bool, error) {
+	info, err := I.deps.stat(filePath)
+	if err != nil {
+		return "", false, err
+	}
+	I.mutex.Lock()
+	sizeFound := I.sizes[info.Size()]
+	I.mutex.Unlock()
+	if !sizeFound {
+		return "", false, nil
+	}
+	hash, err := I.deps.hash(filePath)
+	if err != nil {
+		return "", false, err
+	}
+	I.mutex.Lock()
+	path, found := I.paths[contentKey{info.Size(), hex.EncodeToString(hash)}]
+	I.mutex.Unlock()
+	if !found {
+		return "", false, nil
+	}
+	if other, err := I.deps.stat(path); err == nil && os.SameFile(info, other) {
+		return "", false, nil
+	}
+	return path, true, nil
+}
+
+// Added records the file just placed at path, so that later sources with the same content are recognized.
+func (I *LibraryIndex) Added(path string) error {
+	info, err := I.deps.stat(path)
+	if err != nil {
+		return err
+	}
+	hash, err := I.deps.hash(path)
+	if err != nil {
+		return err
+	}
+	I.mutex.Lock()
+	defer I.mutex.Unlock()
+	I.add(path, contentKey{info.Size(), hex.EncodeToString(hash)})
+	return nil
+}
+
+// libraryIndexes builds, once per destination, the indexes used by 'skip-duplicates'.
+type libraryIndexes struct {
+	mutex   sync.Mutex
+	indexes map[string]*LibraryIndex
+	errs    map[string]error
+}
+
+// get returns the index of destination, building it on the first call; an index failing only to save its cache is returned along with the error, only once.
+func (I *libraryIndexes) get(destination string, rules RuleSet, dryRun bool, deps dependencies) (*LibraryIndex, error) {
+	I.mutex.Lock()
+	defer I.mutex.Unlock()
+	if I.indexes == nil {
+		I.indexes, I.errs = map[string]*LibraryIndex{}, map[string]error{}
+	}
+	if index, found := I.indexes[destination]; found {
+		if index == nil {
+			return nil, I.errs[destination]
+		}
+		return index, nil
+	}
+	index, err := BuildLibraryIndex(destination, rules, dryRun, deps)
+	I.indexes[destination], I.errs[destination] = index, err
+	return index, err
+}
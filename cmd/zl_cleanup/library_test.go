@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryIndex(t *testing.T) {
+	library, downloads := t.TempDir(), t.TempDir()
+	writeFiles(t, library, map[string]string{
+		"business/Drive.pdf":          "drive",
+		"Flow.pdf":                    "flow",
+		"Flow, again (z-lib.org).pdf": "dirty files aren't part of the library",
+	})
+	writeFiles(t, downloads, map[string]string{
+		"Drive (z-lib.org).pdf":   "drive",
+		"Unknown (z-lib.org).pdf": "flow?",
+		"Dirty (z-lib.org).pdf":   "dirty files aren't part of the library",
+	})
+	index, err := BuildLibraryIndex(library, DefaultRuleSet(), false, osDependencies())
+	require.NoError(t, err)
+
+	path, found, err := index.Find(filepath.Join(downloads, "Drive (z-lib.org).pdf"))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, filepath.Join(library, "business", "Drive.pdf"), path)
+
+	for _, name := range []string{"Unknown (z-lib.org).pdf", "Dirty (z-lib.org).pdf"} {
+		_, found, err = index.Find(filepath.Join(downloads, name))
+		require.NoError(t, err)
+		assert.False(t, found, name)
+	}
+	_, found, err = index.Find(filepath.Join(library, "Flow.pdf"))
+	require.NoError(t, err)
+	assert.False(t, found, "a file isn't a duplicate of itself")
+
+	require.NoError(t, os.Rename(filepath.Join(downloads, "Unknown (z-lib.org).pdf"), filepath.Join(library, "Unknown.pdf")))
+	require.NoError(t, index.Added(filepath.Join(library, "Unknown.pdf")))
+	writeFiles(t, downloads, map[string]string{"Unknown, again (z-lib.org).pdf": "flow?"})
+	path, found, err = index.Find(filepath.Join(downloads, "Unknown, again (z-lib.org).pdf"))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, filepath.Join(library, "Unknown.pdf"), path)
+}
+
+func TestLibraryIndexCache(t *testing.T) {
+	library := t.TempDir()
+	writeFiles(t, library, map[string]string{"Flow.pdf": "flow"})
+	if _, err := statFileID(filepath.Join(library, "Flow.pdf")); err != nil {
+		t.Skip("the cache is keyed by inode:", err)
+	}
+	_, err := BuildLibraryIndex(library, DefaultRuleSet(), false, osDependencies())
+	require.NoError(t, err)
+
+	cachePath := filepath.Join(library, libraryIndexName)
+	content, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+	var cached []indexedFile
+	require.NoError(t, json.Unmarshal(content, &cached))
+	require.Len(t, cached, 1)
+	assert.Equal(t, int64(4), cached[0].Size)
+
+	// a cached hash is trusted as long as the file has the same inode and modification time
+	cached[0].Hash = "cafe"
+	content, err = json.Marshal(cached)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cachePath, content, 0o644))
+	index, err := BuildLibraryIndex(library, DefaultRuleSet(), true, osDependencies())
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(library, "Flow.pdf"), index.paths[contentKey{4, "cafe"}])
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// How a source is placed into a destination.
+const (
+	hardlinkMode = "hardlink"
+	symlinkMode  = "symlink"
+	reflinkMode  = "reflink"
+	copyMode     = "copy"
+	// hardlink, falling back to reflink and then to copy when the destination is on another file system, or on one without hard links
+	autoMode = "auto"
+)
+
+// linkFunc creates newPath from oldPath, failing with fs.ErrExist if newPath is taken.
+type linkFunc func(oldPath, newPath string) error
+
+// linker returns the linkFunc of mode; profileOf, telling the file system of a directory, defaults to its detection.
+func (I dependencies) linker(mode string, profileOf func(dir string) FSProfile) (linkFunc, error) {
+	switch mode {
+	case hardlinkMode:
+		return I.hardlink, nil
+	case symlinkMode:
+		return I.symlink, nil
+	case reflinkMode:
+		return I.reflink, nil
+	case copyMode:
+		return I.copy, nil
+	case autoMode:
+		if profileOf == nil {
+			profileOf = Config{}.fsProfileFor
+		}
+		return I.autoLinker(profileOf), nil
+	default:
+		return nil, fmt.Errorf("unknown link mode %q", mode)
+	}
+}
+
+func (I dependencies) autoLinker(profileOf func(dir string) FSProfile) linkFunc {
+	return func(oldPath, newPath string) error {
+		err := I.hardlink(oldPath, newPath)
+		if !hardlinkUnsupported(err, profileOf, filepath.Dir(newPath)) {
+			return err
+		}
+		err = I.reflink(oldPath, newPath)
+		if err == nil || errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		return I.copy(oldPath, newPath)
+	}
+}
+
+// isCrossDevice tells if err is the failure of linking, or renaming, across file systems.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+/*
+hardlinkUnsupported tells if err is the failure of hard linking into dir because it can't hold the link:
+it's on another file system, or on one without hard links, like FAT or SMB, that reports EPERM instead.
+Anywhere else EPERM is a real permission error, like protected_hardlinks or an immutable file.
+*/
+func hardlinkUnsupported(err error, profileOf func(dir string) FSProfile, dir string) bool {
+	return isCrossDevice(err) || (errors.Is(err, syscall.EPERM) && profileOf(dir).NoHardLinks)
+}
+
+// reflink clones oldPath into a new file sharing the same data blocks, on file systems supporting it (btrfs, xfs, ...).
+func reflink(oldPath, newPath string) error {
+	return cloneInto(oldPath, newPath, func(src, dst *os.File) error {
+		if err := cloneFile(src, dst); err != nil {
+			return &os.LinkError{Op: "reflink", Old: oldPath, New: newPath, Err: err}
+		}
+		return nil
+	})
+}
+
+// verifiedCopy copies oldPath, fsync-ing and reading back the copy to compare it with the original.
+func verifiedCopy(oldPath, newPath string) error {
+	return cloneInto(oldPath, newPath, func(src, dst *os.File) error {
+		if _, err := io.Copy(dst, src); err != nil {
+			return err
+		}
+		if err := dst.Sync(); err != nil {
+			return err
+		}
+		srcHash, err := fileHash(oldPath)
+		if err != nil {
+			return err
+		}
+		dstHash, err := fileHash(newPath)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(srcHash, dstHash) {
+			return &os.LinkError{Op: "copy", Old: oldPath, New: newPath, Err: errors.New("copy differs from the original")}
+		}
+		return nil
+	})
+}
+
+// cloneInto creates newPath, with the permissions and modification time of oldPath, filling it with fill; newPath is removed if anything fails.
+func cloneInto(oldPath, newPath string, fill func(src, dst *os.File) error) (err error) {
+	src, err := os.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(newPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chtimes(newPath, info.ModTime(), info.ModTime())
+		}
+		if err != nil {
+			os.Remove(newPath)
+		}
+	}()
+	if err := fill(src, dst); err != nil {
+		return err
+	}
+	return dst.Chmod(info.Mode().Perm())
+}
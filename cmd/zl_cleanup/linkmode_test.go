@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifiedCopyPreservesMetadata(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.pdf")
+	writeFiles(t, dir, map[string]string{"source.pdf": "content"})
+	require.NoError(t, os.Chmod(source, 0o640))
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	require.NoError(t, os.Chtimes(source, mtime, mtime))
+
+	copied := filepath.Join(dir, "copy.pdf")
+	require.NoError(t, verifiedCopy(source, copied))
+
+	info, err := os.Stat(copied)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	assert.True(t, mtime.Equal(info.ModTime()))
+	assert.True(t, osDependencies().identical(source, copied))
+	assert.False(t, osDependencies().alreadyLinked(source, copied))
+}
+
+func TestLinkModesDoNotOverwrite(t *testing.T) {
+	for _, mode := range []string{hardlinkMode, symlinkMode, copyMode, autoMode} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"source.pdf": "source", "taken.pdf": "taken"})
+			link, err := osDependencies().linker(mode, nil)
+			require.NoError(t, err)
+
+			err = link(filepath.Join(dir, "source.pdf"), filepath.Join(dir, "taken.pdf"))
+
+			assert.ErrorIs(t, err, os.ErrExist)
+			content, _ := os.ReadFile(filepath.Join(dir, "taken.pdf"))
+			assert.Equal(t, "taken", string(content))
+		})
+	}
+}
+
+func TestAutoLinkPrefersHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"source.pdf": "source"})
+	source := filepath.Join(dir, "source.pdf")
+	linked := filepath.Join(dir, "linked.pdf")
+
+	require.NoError(t, osDependencies().autoLinker(Config{}.fsProfileFor)(source, linked))
+
+	assert.True(t, osDependencies().alreadyLinked(source, linked))
+}
+
+func TestHardlinkUnsupported(t *testing.T) {
+	profileOf := func(name string) func(string) FSProfile {
+		return func(string) FSProfile { return fsProfiles[name] }
+	}
+	linkErr := func(errno syscall.Errno) error {
+		return &os.LinkError{Op: "link", Old: "a", New: "b", Err: errno}
+	}
+	assert.True(t, hardlinkUnsupported(linkErr(syscall.EXDEV), profileOf("ext4"), "/dest"))
+	assert.True(t, hardlinkUnsupported(linkErr(syscall.EPERM), profileOf("fat"), "/dest"))
+	assert.True(t, hardlinkUnsupported(linkErr(syscall.EPERM), profileOf("smb"), "/dest"))
+	assert.False(t, hardlinkUnsupported(linkErr(syscall.EPERM), profileOf("ext4"), "/dest"), "EPERM is a permission error where hard links are supported")
+	assert.False(t, hardlinkUnsupported(linkErr(syscall.EACCES), profileOf("fat"), "/dest"))
+	assert.False(t, hardlinkUnsupported(nil, profileOf("fat"), "/dest"))
+}
@@ -5,25 +5,18 @@ import (
 	"flag"
 	"fmt"
 	"io/fs"
-	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"dev.acorello.it/go/arkivist/cmd/zl_cleanup/fileset"
-	"github.com/fatih/color"
 )
 
-/* TODO: improve the error message if we call the command without source and destination.
-
-> zl_cleanup -summary
-invalid directory: blank
-invalid directory: blank
-
-*/
-
 type destinations []string
 
 func (me *destinations) String() string {
@@ -41,8 +34,29 @@ func (me *destinations) Set(destination string) error {
 	return nil
 }
 
+// globs is a repeatable flag of filepath.Match patterns.
+type globs []string
+
+func (me *globs) String() string {
+	if me == nil {
+		return ""
+	}
+	return strings.Join(*me, " ")
+}
+
+func (me *globs) Set(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	*me = append(*me, pattern)
+	return nil
+}
+
 var (
-	destinationsDirectoryFlag *destinations = new(destinations)
+	destinationsDirectoryFlag *destinations  = new(destinations)
+	includeFlag               *globs         = new(globs)
+	fsProfilesFlag            *fsProfileFlag = &fsProfileFlag{}
+	excludeFlag               *globs         = new(globs)
 
 	justPrintConfigFlag = flag.Bool("justconfig", false, "print only the final job configuration")
 	onlyFailedFlag      = flag.Bool("onlyfailed", false, "print only files that failed cleanup")
@@ -50,13 +64,37 @@ var (
 	doRunFlag           = flag.Bool("run", false, "execute the operation")
 	doTrashFlag         = flag.Bool("trash", false, "trash successfully moved files")
 	doDeleteFlag        = flag.Bool("delete", false, "delete successfully moved files")
+	quarantineFlag      = flag.String("quarantine", "", "move successfully moved files into a dated batch of this directory, see the 'purge' sub-command")
+	recursiveFlag       = flag.Bool("recursive", false, "descend into sub-directories of the source directory")
+	flattenFlag         = flag.Bool("flatten", false, "with 'recursive', link every file directly into the destination instead of mirroring its sub-directory")
+	explainFlag         = flag.Bool("explain", false, "print which rule changed which part of each filename")
+	rulesFileFlag       = flag.String("rules", "", "TOML file with the cleaning rules; defaults to the built-in z-library rules")
+	normalizeFlag       = flag.String("normalize", "", "normalize filenames before the rules, replacing the [normalize] table of the rules file: a comma separated list of NFC, NFD, NFKC or NFKD, strip-invisible, strip-emoji, fold-quotes and transliterate, or none")
 	sourceDirectoryFlag = flag.String("source", "", "directory containing files to clean-up")
 	summaryFlag         = flag.Bool("summary", false, "print list of final filenames at the end")
+	formatFlag          = flag.String("format", textFormat, "report format: text, json or ndjson (streamed)")
+	onConflictFlag      = flag.String("on-conflict", skipOnConflict, "when the clean name is taken by a different file: skip, suffix, replace-if-identical or fail; the source is deleted only if a destination holds the same bytes")
+	linkModeFlag        = flag.String("link-mode", hardlinkMode, "how to place files into destinations: hardlink, symlink, reflink, copy or auto (hardlink, then reflink, then copy)")
+	configFileFlag      = flag.String("config", defaultConfigPath(), "TOML file with the job profiles")
+	profileFlag         = flag.String("profile", "", "name of the profile, in the config file, providing the values of the flags not given")
+	watchFlag           = flag.Bool("watch", false, "after cleaning the source directory, keep cleaning the files landing there until interrupted (Linux only)")
+	settleFlag          = flag.Duration("settle", 2*time.Second, "with 'watch', how long a file should stop growing before being cleaned")
+	fsReservedFlag      = flag.String("fs-reserved", replaceReserved, "characters and names reserved by a destination file system are either replaced or rejected: replace or reject")
+	interactiveFlag     = flag.Bool("interactive", false, "with 'run', ask to accept, skip or rename each file; without a terminal nothing is applied")
+	onCollisionFlag     = flag.String("on-collision", disambiguateCollisions, "when different sources clean to the same name: disambiguate (identical files are linked once, the others get a numeric suffix) or refuse the whole batch")
+	maxErrorsFlag       = flag.Int("max-errors", 0, "stop once this many errors were reported, leaving the sources in place; 0 never stops")
+	skipDuplicatesFlag  = flag.Bool("skip-duplicates", false, "don't link sources whose content a destination already holds under any name; their hashes are cached in "+libraryIndexName+" at the root of each destination")
+	jobsFlag            = flag.Int("jobs", 1, "number of files processed in parallel; the report keeps the order of the source paths")
+	templateFlag        = flag.String("template", "", "Go text/template naming books after their EPUB or PDF metadata, e.g. '{{.Title}} - {{.Author}}' or 'canonical' for \"ISBN • Title • by Author • Publisher\"; files without a title keep the cleaned name")
+	journalFlag         = flag.String("journal", "", "with 'run', file where to record the operations for 'undo'; defaults to $XDG_STATE_HOME/zl_cleanup/<timestamp>.jsonl")
 )
 
 func init() {
 	const destinationHelpMsg = "directory where you want to place the ranamed file; can be repeated"
 	flag.Var(destinationsDirectoryFlag, "destination", destinationHelpMsg)
+	flag.Var(fsProfilesFlag, "fs", "file system profile of a destination, as DIR=PROFILE where PROFILE is ext4, exfat, fat, smb or macos; detected when not given; can be repeated")
+	flag.Var(includeFlag, "include", "only process files whose name or relative path matches the glob; can be repeated")
+	flag.Var(excludeFlag, "exclude", "skip files and directories whose name or relative path matches the glob (e.g. '*.part', '.*'); can be repeated")
 }
 
 type Config struct {
@@ -65,8 +103,31 @@ type Config struct {
 	quiet                  bool
 	doRun                  bool
 	deleteMethod           string
+	quarantineDirectory    string
 	sourceDirectory        string
 	summary                bool
+	explain                bool
+	rules                  RuleSet
+	recursive              bool
+	flatten                bool
+	include                []string
+	exclude                []string
+	journalPath            string
+	format                 string
+	onConflict             string
+	linkMode               string
+	watch                  bool
+	settle                 time.Duration
+	fsProfiles             map[string]string
+	fsReserved             string
+	interactive            bool
+	jobs                   int
+	maxErrors              int
+	skipDuplicates         bool
+	onCollision            string
+	template               *nameTemplate
+	// origins tells where each flag value comes from
+	origins map[string]string
 }
 
 func (I Config) dryRun() bool {
@@ -75,35 +136,77 @@ func (I Config) dryRun() bool {
 
 func (I Config) Errors() (errors []error) {
 	if I.doRun && I.onlyPrintFailed {
-		errors = append(errors, fmt.Errorf("either 'rename' or 'onlyFailed' should be requested"))
+		errors = append(errors, fmt.Errorf("either 'run' or 'onlyfailed' should be requested"))
+	}
+	if I.flatten && !I.recursive {
+		errors = append(errors, fmt.Errorf("'flatten' makes sense only with 'recursive'"))
 	}
 	if I.deleteMethod != "" && !I.doRun {
-		errors = append(errors, fmt.Errorf("'trash' or 'delete' flags make sense only with 'run'"))
+		errors = append(errors, fmt.Errorf("'trash', 'delete' or 'quarantine' flags make sense only with 'run'"))
+	}
+	if strings.TrimSpace(I.sourceDirectory) == "" {
+		return append(errors, fmt.Errorf("'source' is required"))
 	}
-	errors = append(errors, missingDirectoriesErrors(I.destinationDirectories...)...)
 	errors = append(errors, missingDirectoriesErrors(I.sourceDirectory)...)
+	for _, destination := range I.destinationDirectories {
+		if destination != I.sourceDirectory {
+			errors = append(errors, missingDirectoriesErrors(destination)...)
+		}
+	}
 	return
 }
 
+// destinationPath mirrors the sub-directory of the source file under destination, unless flattening was requested.
+func (I Config) destinationPath(destination, relPath, cleanName string) string {
+	if I.flatten {
+		return filepath.Join(destination, cleanName)
+	}
+	return filepath.Join(destination, filepath.Dir(relPath), cleanName)
+}
+
 func main() {
-	config, errors := populateConfig()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "undo":
+			undo(os.Args[2:])
+			return
+		case "plan":
+			planCommand(os.Args[2:])
+			return
+		case "apply":
+			applyCommand(os.Args[2:])
+			return
+		case "purge":
+			purgeCommand(os.Args[2:])
+			return
+		}
+	}
+	config, errors := populateConfig(flag.CommandLine, os.Args[1:])
+	errors = append(errors, config.Errors()...)
 	if len(errors) > 0 {
-		fmt.Fprintf(os.Stderr, "Error parsing config:\n%v", errors)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error parsing config:\n%v\n", errors)
+		os.Exit(exitConfigError)
 	}
 	if *justPrintConfigFlag {
-		fmt.Printf("%+v\n", config)
-		os.Exit(0)
+		printFlags(os.Stdout, flag.CommandLine, config.origins)
+		os.Exit(exitSuccess)
+	}
+	if config.watch {
+		os.Exit(watch(config, osDependencies()))
 	}
-	linkToCleanPath(config)
+	os.Exit(linkToCleanPath(config, osDependencies()))
 }
 
 func missingDirectoriesErrors(directories ...string) (errors []error) {
 	invalidErr := func(dir string) (err error) {
-		switch {
-		case len(strings.TrimSpace(dir)) == 0:
+		if len(strings.TrimSpace(dir)) == 0 {
 			return fmt.Errorf("invalid directory: blank")
-		case !directoryExists(dir):
+		}
+		exists, err := directoryExists(dir)
+		switch {
+		case err != nil:
+			return fmt.Errorf("checking directory %q: %w", dir, err)
+		case !exists:
 			return fmt.Errorf("directory does not exists: %q", dir)
 		default:
 			return nil
@@ -117,31 +220,98 @@ func missingDirectoriesErrors(directories ...string) (errors []error) {
 	return
 }
 
-func directoryExists(path string) bool {
+func directoryExists(path string) (bool, error) {
 	_, err := os.Stat(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false
-		} else {
-			log.Panicf("Error checking directory: %s\n", err)
-		}
+	if os.IsNotExist(err) {
+		return false, nil
 	}
-	return true
+	return err == nil, err
 }
 
-func populateConfig() (config Config, errs []error) {
-	flag.Parse()
+// populateConfig parses args with flags, holding the flags of a job, then applies the profile to those not given.
+func populateConfig(flags *flag.FlagSet, args []string) (config Config, errs []error) {
+	flags.Parse(args)
+	var profile Profile
+	if *profileFlag != "" {
+		var err error
+		if profile, err = LoadProfile(*configFileFlag, *profileFlag); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	origins, profileErrs := applyProfile(flags, profile, *profileFlag)
+	errs = append(errs, profileErrs...)
 	config = Config{
+		origins:                origins,
 		destinationDirectories: *destinationsDirectoryFlag,
 		onlyPrintFailed:        *onlyFailedFlag,
 		quiet:                  *quietFlag,
 		doRun:                  *doRunFlag,
 		sourceDirectory:        *sourceDirectoryFlag,
 		summary:                *summaryFlag,
+		explain:                *explainFlag,
+		rules:                  DefaultRuleSet(),
+		recursive:              *recursiveFlag,
+		flatten:                *flattenFlag,
+		include:                *includeFlag,
+		exclude:                *excludeFlag,
+		journalPath:            *journalFlag,
+		format:                 *formatFlag,
+		onConflict:             *onConflictFlag,
+		linkMode:               *linkModeFlag,
+		watch:                  *watchFlag,
+		settle:                 *settleFlag,
+		fsProfiles:             *fsProfilesFlag,
+		fsReserved:             *fsReservedFlag,
+		interactive:            *interactiveFlag,
+		jobs:                   *jobsFlag,
+		maxErrors:              *maxErrorsFlag,
+		skipDuplicates:         *skipDuplicatesFlag,
+		onCollision:            *onCollisionFlag,
+	}
+	if config.fsReserved != replaceReserved && config.fsReserved != rejectReserved {
+		errs = append(errs, fmt.Errorf("'fs-reserved' should be either %q or %q", replaceReserved, rejectReserved))
+	}
+	if config.watch && config.settle <= 0 {
+		errs = append(errs, fmt.Errorf("'settle' should be a positive duration"))
+	}
+	if _, err := osDependencies().linker(config.linkMode, nil); err != nil {
+		errs = append(errs, err)
+	}
+	switch config.onConflict {
+	case skipOnConflict, suffixOnConflict, replaceIfIdenticalOnConflict, failOnConflict:
+	default:
+		errs = append(errs, fmt.Errorf("unknown conflict policy %q", config.onConflict))
+	}
+	switch config.onCollision {
+	case disambiguateCollisions, refuseCollisions:
+	default:
+		errs = append(errs, fmt.Errorf("unknown collision policy %q", config.onCollision))
+	}
+	if err := formatError(config.format); err != nil {
+		errs = append(errs, err)
 	}
 
-	if *doDeleteFlag && *doTrashFlag {
-		errs = append(errs, fmt.Errorf("either delete or trash flags should be given"))
+	if *templateFlag != "" {
+		template, err := parseNameTemplate(*templateFlag)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		config.template = template
+	}
+
+	if *rulesFileFlag != "" {
+		rules, rulesErrs := LoadRuleSet(*rulesFileFlag)
+		errs = append(errs, rulesErrs...)
+		config.rules = rules
+	}
+	if *normalizeFlag != "" {
+		if err := config.rules.normalizeWith(*normalizeFlag); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if countTrue(*doDeleteFlag, *doTrashFlag, *quarantineFlag != "") > 1 {
+		errs = append(errs, fmt.Errorf("either delete, trash or quarantine flags should be given"))
 	} else {
 		if *doTrashFlag {
 			config.deleteMethod = "trash"
@@ -149,6 +319,46 @@ func populateConfig() (config Config, errs []error) {
 		if *doDeleteFlag {
 			config.deleteMethod = "delete"
 		}
+		if *quarantineFlag != "" {
+			config.deleteMethod = quarantineMethod
+			if quarantineDirectory, err := filepath.Abs(*quarantineFlag); err != nil {
+				errs = append(errs, errors.Join(errors.New("filepath.Abs(<quarantine-directory>) failed"), err))
+			} else {
+				config.quarantineDirectory = quarantineDirectory
+			}
+		}
+	}
+	if config.interactive && !config.doRun {
+		errs = append(errs, fmt.Errorf("'interactive' makes sense only with 'run'"))
+	}
+	if config.maxErrors < 0 {
+		errs = append(errs, fmt.Errorf("'max-errors' can't be negative"))
+	}
+	if config.jobs < 1 {
+		errs = append(errs, fmt.Errorf("'jobs' should be at least 1"))
+	}
+	if config.interactive && config.jobs > 1 {
+		errs = append(errs, fmt.Errorf("'interactive' reviews one file at a time: don't use it with 'jobs'"))
+	}
+	if config.interactive && !stdinIsTerminal() {
+		fmt.Fprintln(os.Stderr, "stdin is not a terminal, 'interactive' falls back to a dry run")
+		config.interactive = false
+		config.doRun = false
+		config.deleteMethod = ""
+	}
+	if config.doRun && config.journalPath == "" {
+		if journalPath, err := defaultJournalPath(time.Now()); err != nil {
+			errs = append(errs, errors.Join(errors.New("cannot locate the journal directory"), err))
+		} else {
+			config.journalPath = journalPath
+		}
+	}
+	if config.linkMode == symlinkMode && config.deleteMethod != "" {
+		errs = append(errs, fmt.Errorf("symbolic links would dangle once their source is removed: don't use 'symlink' with 'trash', 'delete' or 'quarantine'"))
+	}
+	if strings.TrimSpace(config.sourceDirectory) == "" {
+		// reported by Config.Errors
+		return config, errs
 	}
 	if len(config.destinationDirectories) == 0 {
 		config.destinationDirectories = []string{config.sourceDirectory}
@@ -170,191 +380,334 @@ func populateConfig() (config Config, errs []error) {
 	return config, errs
 }
 
-type Summary struct {
-	out strings.Builder
-	err strings.Builder
-	Config
-}
-
-func (I *Summary) fmtSummary(format string, a ...any) {
-	if I.quiet {
-		return
+func countTrue(values ...bool) (n int) {
+	for _, v := range values {
+		if v {
+			n++
+		}
 	}
-	I.out.WriteString(fmt.Sprintf(format, a...))
+	return
 }
 
-func (I *Summary) fmtErr(format string, a ...any) {
-	if I.quiet {
-		return
+// job cleans files, a batch after the other, sharing the same report and journal.
+type job struct {
+	Config
+	report   Reporter
+	link     linkFunc
+	journal  *Journal
+	reviewer reviewer
+	locks    *pathLocks
+	// taken are the paths planned for the sources of the batch being cleaned
+	taken     map[string]bool
+	deps      dependencies
+	libraries libraryIndexes
+	// quarantine is set when sources are quarantined
+	quarantine *Quarantine
+	// aborted is set once 'max-errors' is reached, or the batch is refused
+	aborted bool
+}
+
+// newJob fails, before anything is attempted, on an unknown link mode or a journal that can't be opened.
+func newJob(config Config, deps dependencies) (*job, error) {
+	link, err := deps.linker(config.linkMode, config.fsProfileFor)
+	if err != nil {
+		return nil, err
 	}
-	I.err.WriteString(fmt.Sprintf(format, a...))
-}
-
-func (I *Summary) Entry(header, dirPath, fileName string) {
-	header = color.GreenString(header + ":")
-	I.fmtSummary("%s %s\n\t%s\n", header, dirPath, fileName)
-}
-func (I *Summary) Source(filePath string) {
-	fileName := filepath.Base(filePath)
-	fileName = color.HiGreenString("%s", fileName)
-	dirPath := filepath.Dir(filePath)
-	dirPath = color.GreenString("%s", dirPath)
-	I.Entry("SOURCE", dirPath, fileName)
-}
-func (I *Summary) LinkPreview(oldPath, filePath string) {
-	fileName := filepath.Base(filePath)
-	fileName = color.HiWhiteString("%s", fileName)
-	dirPath := filepath.Dir(filePath)
-	dirPath = color.WhiteString("%s", dirPath)
-	I.Entry("LINK??", dirPath, fileName)
-}
-func (I *Summary) Linked(oldPath, filePath string) {
-	fileName := filepath.Base(filePath)
-	fileName = color.HiCyanString("%s", fileName)
-	dirPath := filepath.Dir(filePath)
-	dirPath = color.CyanString("%s", dirPath)
-	I.Entry("LINKED", dirPath, fileName)
-}
-
-func (I *Summary) Homonym(oldPath, filePath string) {
-	fileName := filepath.Base(filePath)
-	fileName = color.HiBlueString("%s", fileName)
-	dirPath := filepath.Dir(filePath)
-	dirPath = color.BlueString("%s", dirPath)
-	I.Entry("HMONYM", dirPath, fileName)
-}
-
-func (I *Summary) Trashing(filePath string) {
-	fileName := filepath.Base(filePath)
-	fileName = color.HiYellowString("%s", fileName)
-	dirPath := filepath.Dir(filePath)
-	dirPath = color.YellowString("%s", dirPath)
-	I.Entry("TRASHING", dirPath, fileName)
+	var journal *Journal
+	if !config.dryRun() {
+		if journal, err = OpenJournal(config.journalPath, deps); err != nil {
+			return nil, fmt.Errorf("opening journal: %w", err)
+		}
+	}
+	job := &job{
+		Config:  config,
+		report:  NewReporter(config, deps.stdout, deps.stderr),
+		link:    link,
+		journal: journal,
+		locks:   newPathLocks(),
+		deps:    deps,
+	}
+	if config.interactive {
+		job.reviewer = newPromptReviewer(deps.stdin, deps.stderr)
+	}
+	if config.deleteMethod == quarantineMethod {
+		job.quarantine = NewQuarantine(config.quarantineDirectory, config.sourceDirectory, time.Now, deps)
+	}
+	return job, nil
 }
 
-func (I *Summary) Error(oldPath, filePath string, err error) {
-	fileName := filepath.Base(filePath)
-	fileName = color.RedString("%s", fileName)
-	dirPath := filepath.Dir(filePath)
-	dirPath = color.RedString("%s", dirPath)
-	errMessage := color.HiRedString(err.Error())
-	header := color.RedString("ERROR:")
-	I.fmtErr("%s %s\n\t%s\n\t%s\n", header, dirPath, fileName, errMessage)
+func (I *job) close() {
+	I.journal.Close()
+	I.quarantine.Close()
 }
 
-func (I *Summary) Len() int {
-	return I.out.Len() + I.err.Len()
+// linkToCleanPath cleans the source directory once, returning the exit code.
+func linkToCleanPath(config Config, deps dependencies) int {
+	job, err := newJob(config, deps)
+	if err != nil {
+		fmt.Fprintf(deps.stderr, "Error starting:\n%v\n", err)
+		return exitConfigError
+	}
+	defer job.close()
+	files, err := dirtyFiles(config, deps)
+	if err != nil {
+		fmt.Fprintf(deps.stderr, "Error listing sources:\n%v\n", err)
+		return exitConfigError
+	}
+	job.removeSources(job.clean(files))
+	job.report.Print()
+	return exitCode(job.report.Totals(), job.aborted)
 }
 
-func (I *Summary) Print() {
-	if !I.quiet && I.Len() == 0 {
-		I.fmtSummary("Nothing to report\n")
+// tooManyErrors tells, once 'max-errors' is reached, the job should stop.
+func (I *job) tooManyErrors() bool {
+	if I.maxErrors > 0 && I.report.Totals().Errors >= I.maxErrors {
+		I.aborted = true
 	}
-	fmt.Fprint(os.Stdout, I.out.String())
-	fmt.Fprint(os.Stderr, I.err.String())
+	return I.aborted
 }
 
-func NewSummary(config Config) Summary {
-	return Summary{
-		Config: config,
+// clean links each file at its clean path in every destination, returning the files now safe to remove.
+func (I *job) clean(files []sourceFile) (successfullyLinkedFiles fileset.FileSet) {
+	successfullyLinkedFiles = fileset.New()
+	sort.Slice(files, func(i, j int) bool { return files[i].relPath < files[j].relPath })
+	plan := make([]*plannedFile, len(files))
+	for i, dirtyFile := range files {
+		plan[i] = I.propose(dirtyFile)
+	}
+	if refused := I.resolveCollisions(plan); refused {
+		for _, p := range plan {
+			p.events.replay(I.report)
+		}
+		I.aborted = true
+		return
+	}
+	if I.jobs > 1 {
+		I.cleanConcurrently(plan, successfullyLinkedFiles.Add)
+		return
+	}
+	for _, p := range plan {
+		if I.tooManyErrors() {
+			return
+		}
+		p.events.replay(I.report)
+		if p.valid && I.apply(p, I.report) {
+			successfullyLinkedFiles.Add(p.oldPath)
+		}
 	}
+	return
 }
 
-func fileExists(filePath string) bool {
-	_, err := os.Stat(filePath)
-	return !os.IsNotExist(err)
+// plannedFile is the clean name planned for a source file, along with the events reported while planning it.
+type plannedFile struct {
+	sourceFile
+	oldPath   string
+	cleanName string
+	events    recorder
+	// valid is false when the file is not to be placed
+	valid bool
+}
+
+// propose works out the clean name of dirtyFile.
+func (I *job) propose(dirtyFile sourceFile) *plannedFile {
+	p := &plannedFile{sourceFile: dirtyFile, oldPath: filepath.Join(I.sourceDirectory, dirtyFile.relPath)}
+	report := &p.events
+	dirtyName := dirtyFile.Name()
+	cleanName, changes := I.rules.Clean(dirtyName)
+	if I.template != nil {
+		templatedName, err := I.template.rename(p.oldPath, cleanName)
+		if err != nil {
+			report.Error(p.oldPath, p.oldPath, err)
+			return p
+		}
+		if templatedName != cleanName {
+			changes = append(changes, Change{Rule: "template", Before: cleanName, After: templatedName})
+			cleanName = templatedName
+		}
+	}
+	if I.explain {
+		report.Explain(dirtyName, changes)
+	}
+	if hasFailures(report, p.oldPath, cleanName) || I.onlyPrintFailed {
+		return p
+	}
+	p.cleanName, p.valid = cleanName, true
+	return p
 }
 
-func linkToCleanPath(config Config) {
-	report := NewSummary(config)
-	sourceDirectory := config.sourceDirectory
-	successfullyLinkedFiles := fileset.New()
-	for _, dirtyFile := range dirtyFiles(sourceDirectory) {
-		dirtyName := dirtyFile.Name()
-		cleanName := cleanFilename(dirtyName)
-		if hasFailures(&report, dirtyName, cleanName) || config.onlyPrintFailed {
+// apply links the proposed file at its clean path in every destination, telling whether the source is now safe to remove.
+func (I *job) apply(p *plannedFile, report Reporter) (linked bool) {
+	cleanName := p.cleanName
+	if I.reviewer != nil {
+		var approved bool
+		if cleanName, approved = I.reviewer.review(p.oldPath, cleanName, I.planFor(p)); !approved {
+			return false
+		}
+	}
+	report.Source(p.oldPath)
+	linked = true //assume ok, unset if err
+	for _, destination := range I.destinationDirectories {
+		destinationName, adjustments, err := I.fsProfileFor(destination).Adjust(cleanName, I.fsReserved)
+		newPath := I.destinationPath(destination, p.relPath, destinationName)
+		if err != nil {
+			report.Error(p.oldPath, newPath, err)
+			linked = false
 			continue
 		}
-		oldPath := filepath.Join(sourceDirectory, dirtyName)
-		successfullyLinkedFiles.Add(oldPath) //assume ok, remove if err
-		for _, destination := range config.destinationDirectories {
-			newPath := filepath.Join(destination, cleanName)
-			if config.dryRun() {
-				if fileExists(newPath) {
-					report.Homonym(oldPath, newPath)
-				} else {
-					report.LinkPreview(oldPath, newPath)
-				}
-			} else {
-				err, gotErr := os.Link(oldPath, newPath).(*os.LinkError)
-				switch {
-				case !gotErr:
-					report.Linked(oldPath, newPath)
-				case errors.Is(err, os.ErrExist):
-					report.Homonym(oldPath, newPath)
-				default:
-					report.Error(err.Old, err.New, err.Err)
-					successfullyLinkedFiles.Remove(oldPath)
+		for _, adjustment := range adjustments {
+			report.Adjusted(newPath, adjustment)
+		}
+		var library *LibraryIndex
+		if I.skipDuplicates {
+			if library, err = I.libraries.get(destination, I.rules, I.dryRun(), I.deps); err != nil {
+				report.Error(p.oldPath, destination, err)
+			}
+			if library == nil {
+				linked = false
+				continue
+			}
+			libraryPath, found, err := library.Find(p.oldPath)
+			if err != nil {
+				report.Error(p.oldPath, newPath, err)
+				linked = false
+				continue
+			}
+			if found {
+				report.AlreadyInLibrary(p.oldPath, libraryPath)
+				if err := I.journal.Kept(p.oldPath, libraryPath); err != nil {
+					report.Error(p.oldPath, libraryPath, err)
 				}
+				continue
+			}
+		}
+		placedPath, ok := I.place(p.oldPath, newPath, report)
+		if !ok {
+			linked = false
+			continue
+		}
+		if library != nil && !I.dryRun() {
+			if err := library.Added(placedPath); err != nil {
+				report.Error(p.oldPath, placedPath, err)
 			}
 		}
 	}
-	switch config.deleteMethod {
+	return
+}
+
+// place links oldPath at newPath, returning the path now holding its content, if any; sources that may end up at the same path, suffixed or not, are placed one at a time.
+func (I *job) place(oldPath, newPath string, report Reporter) (string, bool) {
+	defer I.locks.lock(newPath)()
+	if !I.dryRun() {
+		if err := I.deps.mkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+			report.Error(oldPath, newPath, err)
+			return "", false
+		}
+	}
+	placed, err := I.deps.placeFile(oldPath, newPath, I.onConflict, I.dryRun(), I.link)
+	var linkErr *os.LinkError
+	switch {
+	case errors.As(err, &linkErr):
+		report.Error(linkErr.Old, linkErr.New, linkErr.Err)
+		return "", false
+	case err != nil:
+		report.Error(oldPath, newPath, err)
+		return "", false
+	case placed.outcome == skipped:
+		report.Skipped(oldPath, placed.path)
+		return "", false
+	case placed.outcome == duplicate:
+		report.Homonym(oldPath, placed.path)
+		if err := I.journal.Kept(oldPath, placed.path); err != nil {
+			report.Error(oldPath, placed.path, err)
+		}
+	case I.dryRun():
+		report.LinkPreview(oldPath, placed.path)
+	default:
+		report.Linked(oldPath, placed.path)
+		journaled := I.journal.Linked
+		// an identical file replaced by a link must survive an undo, so it's only restored from
+		if placed.outcome == replaced {
+			journaled = I.journal.Kept
+		}
+		if err := journaled(oldPath, placed.path); err != nil {
+			report.Error(oldPath, placed.path, err)
+		}
+	}
+	return placed.path, true
+}
+
+// removeSources trashes or deletes the linked sources, if a delete method was given and the job wasn't aborted.
+func (I *job) removeSources(successfullyLinkedFiles fileset.FileSet) {
+	if I.aborted {
+		return
+	}
+	switch I.deleteMethod {
 	case "trash":
-		tryTrash(successfullyLinkedFiles, &report)
+		tryTrash(successfullyLinkedFiles, I.report, I.journal, I.deps)
 	case "delete":
-		tryDelete(successfullyLinkedFiles, &report)
-	default:
-		log.Fatal("delete method not supported!", config.deleteMethod)
+		tryDelete(successfullyLinkedFiles, I.report, I.journal, I.deps)
+	case quarantineMethod:
+		tryQuarantine(successfullyLinkedFiles, I.report, I.journal, I.quarantine, I.deps)
 	}
-	report.Print()
 }
 
-func tryDelete(movedFiles fileset.FileSet, report *Summary) {
+func tryDelete(movedFiles fileset.FileSet, report Reporter, journal *Journal, deps dependencies) {
 	if movedFiles.IsEmpty() {
 		return
 	}
-	for fileName := range movedFiles {
+	for _, fileName := range movedFiles.Sorted() {
 		report.Trashing(fileName)
-		if err := os.Remove(fileName); err != nil {
-			report.fmtSummary(color.RedString("ERROR DELETING FILE:\n%s"), fileName)
+		id, _ := deps.statFileID(fileName)
+		if err := deps.remove(fileName); err != nil {
+			report.Error(fileName, fileName, err)
 		} else {
-			report.fmtSummary(color.GreenString("DELETED OK:\n%s"), fileName)
+			report.Deleted(fileName)
+			if err := journal.Removed(fileName, "delete", id); err != nil {
+				report.Error(fileName, fileName, err)
+			}
 		}
 	}
 }
 
-func tryTrash(movedFiles fileset.FileSet, report *Summary) {
+func tryTrash(movedFiles fileset.FileSet, report Reporter, journal *Journal, deps dependencies) {
 	if movedFiles.IsEmpty() {
 		return
 	}
-
-	var fileNames strings.Builder
-	var appendForOSAScript = func(fileName string) {
-		if fileNames.Len() > 0 {
-			fileNames.WriteString(", ")
+	fileNames := movedFiles.Sorted()
+	trasher, err := deps.newTrasher()
+	if err != nil {
+		for _, fileName := range fileNames {
+			report.Error(fileName, fileName, err)
 		}
-		fileNames.WriteString(fmt.Sprintf(`POSIX file "%s"`, fileName))
+		return
 	}
-
-	for fileName := range movedFiles {
+	ids := map[string]fileID{}
+	for _, fileName := range fileNames {
 		report.Trashing(fileName)
-		appendForOSAScript(fileName)
-	}
-
-	osascript := fmt.Sprintf(`tell application "Finder" to delete {%s}`, fileNames.String())
-	cmd := exec.Command("osascript", "-e", osascript)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		report.fmtSummary(color.RedString("ERROR TRASHING FILES:\n%s"), out)
-	} else {
-		report.fmtSummary(color.GreenString("TRASHED OK:\n%s"), out)
+		ids[fileName], _ = deps.statFileID(fileName)
+	}
+	trashErr := trasher.Trash(fileNames...)
+	// the trasher may have failed only on some files: the ones that are gone have been trashed
+	for _, fileName := range fileNames {
+		if deps.fileExists(fileName) {
+			if trashErr == nil {
+				trashErr = errors.New("file still there after trashing")
+			}
+			report.Error(fileName, fileName, trashErr)
+			continue
+		}
+		report.Trashed(fileName)
+		if err := journal.Removed(fileName, "trash", ids[fileName]); err != nil {
+			report.Error(fileName, fileName, err)
+		}
 	}
 }
 
-func hasFailures(s *Summary, dirtyName, fname string) bool {
+func hasFailures(s Reporter, dirtyPath, fname string) bool {
+	dirtyName := filepath.Base(dirtyPath)
+	newPath := filepath.Join(filepath.Dir(dirtyPath), fname)
 	if dirtyName == fname {
-		s.Error(dirtyName, fname, fmt.Errorf("name hasn't changed"))
+		s.Error(dirtyPath, newPath, errNameUnchanged)
 		return true
 	}
 	if substrings := invalidSubstrings(fname); substrings != nil {
@@ -363,9 +716,9 @@ func hasFailures(s *Summary, dirtyName, fname string) bool {
 			if sb.Len() > 0 {
 				sb.WriteString(", ")
 			}
-			sb.WriteString(fmt.Sprintf("%d: %s", sub.position, sub.value))
+			sb.WriteString(fmt.Sprintf("%d: %s %s", sub.position, sub.value, sub.class))
 		}
-		s.Error(dirtyName, fname, fmt.Errorf("found offensive runes at [%s]", sb.String()))
+		s.Error(dirtyPath, newPath, fmt.Errorf("%w at [%s]", errInvalidRunes, sb.String()))
 		return true
 	}
 	return false
@@ -374,6 +727,41 @@ func hasFailures(s *Summary, dirtyName, fname string) bool {
 type invalidSubstring struct {
 	position int
 	value    string
+	// class tells why the rune isn't valid, e.g. "U+200D format (Cf)"
+	class string
+}
+
+// the general categories a rune can be rejected for
+var runeClasses = []struct {
+	category string
+	name     string
+}{
+	{"Cc", "control"},
+	{"Cf", "format"},
+	{"Co", "private use"},
+	{"Cs", "surrogate"},
+	{"Zs", "space separator"},
+	{"Zl", "line separator"},
+	{"Zp", "paragraph separator"},
+	{"Sm", "math symbol"},
+	{"Sc", "currency symbol"},
+	{"Sk", "modifier symbol"},
+	{"So", "other symbol, like emoji"},
+	{"Mc", "spacing mark"},
+	{"Me", "enclosing mark"},
+}
+
+func runeClass(substring string) string {
+	r, size := utf8.DecodeRuneInString(substring)
+	if r == utf8.RuneError && size <= 1 {
+		return "invalid UTF-8"
+	}
+	for _, c := range runeClasses {
+		if unicode.Is(unicode.Categories[c.category], r) {
+			return fmt.Sprintf("%U %s (%s)", r, c.name, c.category)
+		}
+	}
+	return fmt.Sprintf("%U unassigned", r)
 }
 
 func invalidSubstrings(fname string) (res []invalidSubstring) {
@@ -386,57 +774,65 @@ func invalidSubstrings(fname string) (res []invalidSubstring) {
 		from := stringIndices[0]
 		ntil := stringIndices[1]
 		substring := fname[from:ntil]
-		res = append(res, invalidSubstring{from, substring})
+		res = append(res, invalidSubstring{from, substring, runeClass(substring)})
 	}
 	return
 }
 
-func cleanFilename(filename string) string {
-	// for reference: `(?i)\s*\(\s*(?:https?...)?z-lib\.org\s*\)\s*`
-	const space = " "
-	replacer := strings.NewReplacer(
-		"\u00a0", space,
-		"\xa0", space,
-		"\t", space,
-		" (z-lib.org)", "",
-		" (Z-Library)", "",
-		"..", "",
-		"—", "-",
-		"⸺", "-",
-		"⸻", "-",
-		"﹘", "-",
-		"–", "-",
-		"‒", "-",
-	)
-
-	filename = replacer.Replace(filename)
-	rexps := []string{`(\s)\s+`, `(\.)\.+`}
-	for _, rexp := range rexps {
-		multipleSeparators := regexp.MustCompile(rexp)
-		filename = multipleSeparators.ReplaceAllString(filename, `$1`)
-	}
-	return filename
-}
-
-func dirtyFiles(dir string) (dirtyOnes []fs.DirEntry) {
-	isDirty := func(f fs.DirEntry) bool {
-		name := strings.ToLower(f.Name())
-		return f.Type().IsRegular() && strings.Contains(name, "z-lib")
-	}
-	allFiles := filesOrPanic(dir)
-	dirtyOnes = allFiles[:0]
-	for _, f := range allFiles {
-		if isDirty(f) {
-			dirtyOnes = append(dirtyOnes, f)
+// sourceFile is a regular file found under the source directory.
+type sourceFile struct {
+	// relPath is relative to the source directory
+	relPath string
+	fs.DirEntry
+}
+
+// matchesAny reports whether any pattern matches either the base name or the slash-separated relative path.
+func matchesAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, filepath.Base(relPath)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.ToSlash(relPath)); ok {
+			return true
 		}
 	}
-	return
+	return false
 }
 
-func filesOrPanic(dir string) []fs.DirEntry {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		log.Fatal(err)
+// wants tells if the file at relPath, within the source directory, should be cleaned.
+func (I Config) wants(relPath string, f fs.DirEntry) bool {
+	if !f.Type().IsRegular() || matchesAny(I.exclude, relPath) {
+		return false
+	}
+	if len(I.include) > 0 && !matchesAny(I.include, relPath) {
+		return false
 	}
-	return files
+	return I.rules.IsDirty(f.Name())
+}
+
+func dirtyFiles(config Config, deps dependencies) (dirtyOnes []sourceFile, err error) {
+	root := config.sourceDirectory
+	err = deps.walkDir(root, func(path string, f fs.DirEntry, stumbled error) error {
+		if stumbled != nil {
+			return stumbled
+		}
+		if path == root {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			if !config.recursive || matchesAny(config.exclude, relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if config.wants(relPath, f) {
+			dirtyOnes = append(dirtyOnes, sourceFile{relPath, f})
+		}
+		return nil
+	})
+	return
 }
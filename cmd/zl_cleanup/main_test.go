@@ -2,19 +2,14 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TryRun(t *testing.T) {
-	config, err := populateConfig()
-	if err != nil {
-		t.Fatal(err)
-	}
-	linkToCleanPath(config)
-}
-
 func TestHasUnorthodoxRune(t *testing.T) {
 	cases := []struct {
 		filename          string
@@ -26,7 +21,7 @@ func TestHasUnorthodoxRune(t *testing.T) {
 		{
 			filename: "9781101152140 • Drive",
 			invalidSubstrings: []invalidSubstring{
-				{position: 17, value: "\u00a0"},
+				{position: 17, value: "\u00a0", class: "U+00A0 space separator (Zs)"},
 			},
 		},
 		{
@@ -35,6 +30,13 @@ func TestHasUnorthodoxRune(t *testing.T) {
 		{
 			filename: "Mastering Visual Studio Code A Beginner’s Guide.pdf",
 		},
+		{
+			filename: "Go\u200d 🚀.pdf",
+			invalidSubstrings: []invalidSubstring{
+				{position: 2, value: "\u200d", class: "U+200D format (Cf)"},
+				{position: 6, value: "🚀", class: "U+1F680 other symbol, like emoji (So)"},
+			},
+		},
 	}
 	for n, tc := range cases {
 		t.Run(fmt.Sprintf("%0.2d:%q", n, tc.filename), func(t *testing.T) {
@@ -57,3 +59,43 @@ func TestAppendNil(t *testing.T) {
 		t.Errorf("Append added something: %#v", errs)
 	}
 }
+
+func TestDirtyFilesRecursive(t *testing.T) {
+	root := t.TempDir()
+	for _, relPath := range []string{
+		"top (z-lib.org).pdf",
+		"2023-05/nested (z-lib.org).epub",
+		"2023-05/clean.epub",
+		"2023-05/partial (z-lib.org).epub.part",
+		".hidden/secret (z-lib.org).pdf",
+	} {
+		path := filepath.Join(root, relPath)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+	relPaths := func(config Config) (res []string) {
+		files, err := dirtyFiles(config, osDependencies())
+		require.NoError(t, err)
+		for _, f := range files {
+			res = append(res, filepath.ToSlash(f.relPath))
+		}
+		return
+	}
+	config := Config{sourceDirectory: root, rules: DefaultRuleSet()}
+	assert.Equal(t, []string{"top (z-lib.org).pdf"}, relPaths(config))
+
+	config.recursive = true
+	config.exclude = []string{"*.part", ".*"}
+	assert.Equal(t, []string{"2023-05/nested (z-lib.org).epub", "top (z-lib.org).pdf"}, relPaths(config))
+
+	config.include = []string{"*.epub"}
+	assert.Equal(t, []string{"2023-05/nested (z-lib.org).epub"}, relPaths(config))
+}
+
+func TestDestinationPath(t *testing.T) {
+	relPath := filepath.Join("2023-05", "a (z-lib.org).pdf")
+	config := Config{recursive: true}
+	assert.Equal(t, filepath.Join("dst", "2023-05", "a.pdf"), config.destinationPath("dst", relPath, "a.pdf"))
+	config.flatten = true
+	assert.Equal(t, filepath.Join("dst", "a.pdf"), config.destinationPath("dst", relPath, "a.pdf"))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+/*
+Normalization is an optional stage, declared in the rules file or given with `-normalize`, applied to the filename before any rule:
+
+	[normalize]
+	form = "NFC"               # NFC, NFD, NFKC or NFKD; NFKC also folds full-width punctuation
+	strip-invisible = true     # zero-width and bidirectional control characters
+	strip-emoji = true         # pictographic symbols (\p{So}) and their modifiers
+	fold-quotes = true         # ‘’‚‛“”„‟‹›«» become ' and "
+	transliterate = true       # drop accents and spell letters like ø, ß or æ in ASCII
+
+	[normalize.transliterations]
+	"ü" = "ue"                 # applied before, and taking precedence over, the built-in ones
+*/
+type Normalization struct {
+	Form             string            `toml:"form"`
+	StripInvisible   bool              `toml:"strip-invisible"`
+	StripEmoji       bool              `toml:"strip-emoji"`
+	FoldQuotes       bool              `toml:"fold-quotes"`
+	Transliterate    bool              `toml:"transliterate"`
+	Transliterations map[string]string `toml:"transliterations"`
+	form             norm.Form
+}
+
+var normalForms = map[string]norm.Form{
+	"NFC":  norm.NFC,
+	"NFD":  norm.NFD,
+	"NFKC": norm.NFKC,
+	"NFKD": norm.NFKD,
+}
+
+/*
+parseNormalization reads the `-normalize` flag: a comma separated list of a form, NFC, NFD, NFKC or NFKD,
+and of strip-invisible, strip-emoji, fold-quotes and transliterate; "none" is no normalization at all.
+*/
+func parseNormalization(value string) (*Normalization, error) {
+	if strings.TrimSpace(value) == "none" {
+		return nil, nil
+	}
+	var n Normalization
+	for _, step := range strings.Split(value, ",") {
+		switch step = strings.TrimSpace(step); step {
+		case "strip-invisible":
+			n.StripInvisible = true
+		case "strip-emoji":
+			n.StripEmoji = true
+		case "fold-quotes":
+			n.FoldQuotes = true
+		case "transliterate":
+			n.Transliterate = true
+		default:
+			if _, isForm := normalForms[strings.ToUpper(step)]; !isForm || n.Form != "" {
+				return nil, fmt.Errorf("normalize: unexpected %q, expected one form among NFC, NFD, NFKC or NFKD, strip-invisible, strip-emoji, fold-quotes or transliterate", step)
+			}
+			n.Form = step
+		}
+	}
+	if errs := n.compile(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return &n, nil
+}
+
+func (I *Normalization) compile() (errs []error) {
+	if I.Form == "" {
+		return nil
+	}
+	form, found := normalForms[strings.ToUpper(I.Form)]
+	if !found {
+		return []error{fmt.Errorf("normalize: unknown form %q, expected one of NFC, NFD, NFKC or NFKD", I.Form)}
+	}
+	I.form = form
+	return nil
+}
+
+type normalizationStep struct {
+	name  string
+	apply func(string) string
+}
+
+func (I Normalization) steps() (steps []normalizationStep) {
+	if I.StripInvisible {
+		steps = append(steps, normalizationStep{"strip invisible", func(s string) string {
+			return strings.Map(dropRunes(isInvisible), s)
+		}})
+	}
+	if I.Form != "" {
+		steps = append(steps, normalizationStep{strings.ToUpper(I.Form), I.form.String})
+	}
+	if I.FoldQuotes {
+		steps = append(steps, normalizationStep{"fold quotes", quoteFolder.Replace})
+	}
+	if I.StripEmoji {
+		steps = append(steps, normalizationStep{"strip emoji", func(s string) string {
+			return strings.Map(dropRunes(isEmoji), s)
+		}})
+	}
+	if I.Transliterate {
+		steps = append(steps, normalizationStep{"transliterate", I.transliterate})
+	}
+	return
+}
+
+// Apply runs every enabled step, returning the normalized name and a change for each step that made one.
+func (I Normalization) Apply(fileName string) (string, []Change) {
+	var changes []Change
+	for _, step := range I.steps() {
+		after := step.apply(fileName)
+		if after != fileName {
+			changes = append(changes, Change{
+				Rule:    "normalize: " + step.name,
+				Matches: changedRunes(fileName, after),
+				Before:  fileName,
+				After:   after,
+			})
+		}
+		fileName = after
+	}
+	return fileName, changes
+}
+
+// changedRunes lists, for explaining, the runes of before missing from after.
+func changedRunes(before, after string) (runes []string) {
+	kept := map[rune]bool{}
+	for _, r := range after {
+		kept[r] = true
+	}
+	seen := map[rune]bool{}
+	for _, r := range before {
+		if !kept[r] && !seen[r] {
+			seen[r] = true
+			runes = append(runes, string(r))
+		}
+	}
+	return
+}
+
+func dropRunes(drop func(rune) bool) func(rune) rune {
+	return func(r rune) rune {
+		if drop(r) {
+			return -1
+		}
+		return r
+	}
+}
+
+func isInvisible(r rune) bool {
+	switch r {
+	case '\u00ad', // soft hyphen
+		'\u061c',                               // arabic letter mark
+		'\u200b', '\u200c', '\u200d', '\u2060', // zero width space, non-joiner, joiner and word joiner
+		'\u200e', '\u200f', // left-to-right and right-to-left marks
+		'\ufeff': // zero width no-break space, the BOM
+		return true
+	}
+	return ('\u202a' <= r && r <= '\u202e') || ('\u2066' <= r && r <= '\u2069') // bidi embeddings, overrides and isolates
+}
+
+func isEmoji(r rune) bool {
+	return unicode.Is(unicode.So, r) ||
+		('\U0001f3fb' <= r && r <= '\U0001f3ff') || // skin tones
+		('\ufe00' <= r && r <= '\ufe0f') || // variation selectors
+		r == '\u200d' // joining emoji sequences
+}
+
+var quoteFolder = strings.NewReplacer(
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "‹", "'", "›", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "«", `"`, "»", `"`,
+)
+
+// letters that don't decompose into an ASCII letter plus marks
+var transliterations = map[rune]string{
+	'ø': "o", 'Ø': "O", 'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+	'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th", 'Þ': "Th", 'ı': "i",
+}
+
+func (I Normalization) transliterate(s string) string {
+	if len(I.Transliterations) > 0 {
+		// longest first, so that overlapping keys behave predictably
+		keys := make([]string, 0, len(I.Transliterations))
+		for k := range I.Transliterations {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+		pairs := make([]string, 0, 2*len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, k, I.Transliterations[k])
+		}
+		s = strings.NewReplacer(pairs...).Replace(s)
+	}
+	var sb strings.Builder
+	// base is the rune the marks that follow are on; only the accents of Latin letters are dropped, not the dakuten of a kana
+	var base rune
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			base = r
+		} else if unicode.Is(unicode.Latin, base) {
+			continue
+		}
+		if t, found := transliterations[r]; found {
+			sb.WriteString(t)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	// recomposes what isn't Latin, like Hangul syllables
+	return norm.NFC.String(sb.String())
+}
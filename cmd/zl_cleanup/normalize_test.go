@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalization(t *testing.T) {
+	cases := []struct {
+		normalization Normalization
+		name          string
+		expected      string
+	}{
+		{
+			normalization: Normalization{Form: "NFC"},
+			name:          "Grønbaek Cafe\u0301.pdf",
+			expected:      "Grønbaek Caf\u00e9.pdf",
+		},
+		{
+			normalization: Normalization{Form: "nfkc"},
+			name:          "Go：Ｔhe Way！.pdf",
+			expected:      "Go:The Way!.pdf",
+		},
+		{
+			normalization: Normalization{StripInvisible: true},
+			name:          "Zero\u200bWidth\u200d \u202eJoiner\u202c.pdf",
+			expected:      "ZeroWidth Joiner.pdf",
+		},
+		{
+			normalization: Normalization{StripEmoji: true},
+			name:          "Rocket 🚀 Science 👍🏽.pdf",
+			expected:      "Rocket  Science .pdf",
+		},
+		{
+			normalization: Normalization{FoldQuotes: true},
+			name:          "A Beginner’s “Guide”.pdf",
+			expected:      `A Beginner's "Guide".pdf`,
+		},
+		{
+			normalization: Normalization{Transliterate: true},
+			name:          "Grønbæk Straße Łódź Café.pdf",
+			expected:      "Gronbaek Strasse Lodz Cafe.pdf",
+		},
+		{
+			normalization: Normalization{Transliterate: true, Transliterations: map[string]string{"ü": "ue", "Ü": "Ue"}},
+			name:          "Über Müller Señor.pdf",
+			expected:      "Ueber Mueller Senor.pdf",
+		},
+		{
+			normalization: Normalization{Transliterate: true},
+			name:          "한국어 ガイド Café.pdf",
+			expected:      "한국어 ガイド Cafe.pdf",
+		},
+	}
+	for n, tc := range cases {
+		t.Run(fmt.Sprintf("%0.2d:%q", n, tc.name), func(t *testing.T) {
+			require.Empty(t, tc.normalization.compile())
+			actual, _ := tc.normalization.Apply(tc.name)
+			assert.Equal(t, tc.expected, actual)
+			assert.Nil(t, invalidSubstrings(actual))
+		})
+	}
+}
+
+func TestNormalizationExplainsChanges(t *testing.T) {
+	normalization := Normalization{StripInvisible: true, FoldQuotes: true}
+	_, changes := normalization.Apply("Beginner’s\u200b Guide.pdf")
+	assert.Equal(t, []Change{
+		{Rule: "normalize: strip invisible", Matches: []string{"\u200b"}, Before: "Beginner’s\u200b Guide.pdf", After: "Beginner’s Guide.pdf"},
+		{Rule: "normalize: fold quotes", Matches: []string{"’"}, Before: "Beginner’s Guide.pdf", After: "Beginner's Guide.pdf"},
+	}, changes)
+}
+
+func TestNormalizationUnknownForm(t *testing.T) {
+	normalization := Normalization{Form: "NFX"}
+	assert.Len(t, normalization.compile(), 1)
+}
+
+func TestNormalizeFlag(t *testing.T) {
+	rules := DefaultRuleSet()
+	require.NoError(t, rules.normalizeWith("nfc, fold-quotes,transliterate"))
+	require.NotNil(t, rules.Normalize)
+	cleanName, _ := rules.Clean("A Beginner’s Cafe\u0301 (z-lib.org).pdf")
+	assert.Equal(t, "A Beginner's Cafe.pdf", cleanName)
+
+	rules.Normalize.Transliterations = map[string]string{"ü": "ue"}
+	require.NoError(t, rules.normalizeWith("transliterate"))
+	assert.Equal(t, map[string]string{"ü": "ue"}, rules.Normalize.Transliterations, "the transliterations of the rules file are kept")
+	assert.Empty(t, rules.Normalize.Form)
+
+	require.NoError(t, rules.normalizeWith("none"))
+	assert.Nil(t, rules.Normalize)
+
+	assert.Error(t, rules.normalizeWith("NFC,NFD"))
+	assert.Error(t, rules.normalizeWith("upper-case"))
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"dev.acorello.it/go/arkivist/cmd/zl_cleanup/fileset"
+)
+
+/*
+A plan file records what a dry run would do, to be reviewed and then applied as is:
+
+	zl_cleanup plan -out plan.json -source ~/Downloads -destination ~/Books -trash
+	zl_cleanup apply plan.json
+
+Each entry carries the size, modification time and hash the source had when planned;
+an entry whose source changed since, or whose destination was taken, has drifted.
+The removal of a source is drifted as well once any file it was found to be a copy of,
+like an identical file already at its clean path or elsewhere in the library, is gone or changed.
+*/
+
+const (
+	skipOnDrift  = "skip"
+	abortOnDrift = "abort"
+)
+
+// replaceOp swaps the identical file at Destination with a link to Source, as the replace-if-identical conflict policy does.
+const replaceOp = "replace"
+
+var errDrifted = errors.New("drifted since planned")
+
+type Plan struct {
+	LinkMode     string `json:"linkMode"`
+	DeleteMethod string `json:"deleteMethod,omitempty"`
+	Quarantine   string `json:"quarantine,omitempty"`
+	// SourceDirectory is the root the quarantine keeps the sub-directories of the sources from
+	SourceDirectory string      `json:"sourceDirectory"`
+	Entries         []PlanEntry `json:"entries"`
+}
+
+// PlanEntry is either a link, or a replacement, from Source to Destination or the removal of Source, when Op is the delete method.
+type PlanEntry struct {
+	Op          string    `json:"op"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination,omitempty"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mtime"`
+	Hash        string    `json:"sha256"`
+	// Keeps are the files, besides those the plan links, whose content makes the removal of Source safe
+	Keeps []KeptCopy `json:"keeps,omitempty"`
+}
+
+// KeptCopy is a file holding the content of a source, with the hash it had when planned.
+type KeptCopy struct {
+	Path string `json:"path"`
+	Hash string `json:"sha256"`
+}
+
+func (I PlanEntry) links() bool {
+	return I.Op == linkOp || I.Op == replaceOp
+}
+
+// target is the path the entry acts on: its destination, or the source it removes.
+func (I PlanEntry) target() string {
+	if I.links() {
+		return I.Destination
+	}
+	return I.Source
+}
+
+// sourceState is what a plan expects to find at a source path.
+type sourceState struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+func readSourceState(filePath string, deps dependencies) (sourceState, error) {
+	info, err := deps.stat(filePath)
+	if err != nil {
+		return sourceState{}, err
+	}
+	hash, err := deps.hash(filePath)
+	if err != nil {
+		return sourceState{}, err
+	}
+	return sourceState{size: info.Size(), modTime: info.ModTime(), hash: hex.EncodeToString(hash)}, nil
+}
+
+// planCollector records, besides reporting them, the links previewed by a dry run and the files already holding the content of each source.
+type planCollector struct {
+	Reporter
+	lstat func(string) (fs.FileInfo, error)
+	links []PlanEntry
+	keeps map[string][]string
+}
+
+func (I *planCollector) LinkPreview(oldPath, filePath string) {
+	I.Reporter.LinkPreview(oldPath, filePath)
+	op := linkOp
+	// a link is previewed at a taken path only to replace an identical file
+	if _, err := I.lstat(filePath); err == nil {
+		op = replaceOp
+	}
+	I.links = append(I.links, PlanEntry{Op: op, Source: oldPath, Destination: filePath})
+}
+
+func (I *planCollector) Homonym(oldPath, filePath string) {
+	I.Reporter.Homonym(oldPath, filePath)
+	I.keeps[oldPath] = append(I.keeps[oldPath], filePath)
+}
+
+func (I *planCollector) AlreadyInLibrary(oldPath, libraryPath string) {
+	I.Reporter.AlreadyInLibrary(oldPath, libraryPath)
+	I.keeps[oldPath] = append(I.keeps[oldPath], libraryPath)
+}
+
+/*
+makePlan dry runs config, recording each link it would create and each source it would remove;
+err tells nothing could be planned, errs the sources whose state couldn't be recorded.
+*/
+func makePlan(config Config, deps dependencies) (plan Plan, totals Totals, aborted bool, errs []error, err error) {
+	job, err := newJob(config, deps)
+	if err != nil {
+		return Plan{}, Totals{}, false, nil, err
+	}
+	defer job.close()
+	files, err := dirtyFiles(config, deps)
+	if err != nil {
+		return Plan{}, Totals{}, false, nil, fmt.Errorf("listing sources: %w", err)
+	}
+	collector := &planCollector{Reporter: job.report, lstat: deps.lstat, keeps: map[string][]string{}}
+	job.report = collector
+	removable := job.clean(files)
+	job.report.Print()
+	totals, aborted = job.report.Totals(), job.aborted
+
+	plan = Plan{
+		LinkMode:        config.linkMode,
+		DeleteMethod:    config.deleteMethod,
+		Quarantine:      config.quarantineDirectory,
+		SourceDirectory: config.sourceDirectory,
+		Entries:         collector.links,
+	}
+	if config.deleteMethod != "" {
+		sources := make([]string, 0, len(removable))
+		for source := range removable {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		for _, source := range sources {
+			entry := PlanEntry{Op: config.deleteMethod, Source: source}
+			for _, kept := range collector.keeps[source] {
+				hash, err := deps.hash(kept)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				entry.Keeps = append(entry.Keeps, KeptCopy{Path: kept, Hash: hex.EncodeToString(hash)})
+			}
+			plan.Entries = append(plan.Entries, entry)
+		}
+	}
+	states := map[string]sourceState{}
+	for i := range plan.Entries {
+		entry := &plan.Entries[i]
+		state, found := states[entry.Source]
+		if !found {
+			var err error
+			if state, err = readSourceState(entry.Source, deps); err != nil {
+				errs = append(errs, err)
+			}
+			states[entry.Source] = state
+		}
+		entry.Size, entry.ModTime, entry.Hash = state.size, state.modTime, state.hash
+	}
+	return
+}
+
+// drift tells whether the entry can't be applied as planned.
+func (I PlanEntry) drift(state sourceState, stateErr error, deps dependencies) error {
+	switch {
+	case stateErr != nil:
+		return fmt.Errorf("%w: %w", errDrifted, stateErr)
+	case state.size != I.Size:
+		return fmt.Errorf("%w: source size is %d instead of %d", errDrifted, state.size, I.Size)
+	case !state.modTime.Equal(I.ModTime):
+		return fmt.Errorf("%w: source modified at %s", errDrifted, state.modTime.Format(time.RFC3339))
+	case state.hash != I.Hash:
+		return fmt.Errorf("%w: source content changed", errDrifted)
+	}
+	switch I.Op {
+	case linkOp:
+		if _, err := deps.lstat(I.Destination); !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: destination exists", errDrifted)
+		}
+	case replaceOp:
+		if !deps.holds(I.Destination, I.Hash) {
+			return fmt.Errorf("%w: destination isn't identical to the source anymore", errDrifted)
+		}
+	default:
+		for _, kept := range I.Keeps {
+			if !deps.holds(kept.Path, kept.Hash) {
+				return fmt.Errorf("%w: the copy at %q is gone or changed", errDrifted, kept.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// holds tells if the file at filePath has the given hash.
+func (I dependencies) holds(filePath, hash string) bool {
+	actual, err := I.hash(filePath)
+	return err == nil && hex.EncodeToString(actual) == hash
+}
+
+func WritePlan(filePath string, plan Plan, deps dependencies) error {
+	content, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return deps.writeFile(filePath, append(content, '\n'), 0o644)
+}
+
+func ReadPlan(filePath string, deps dependencies) (plan Plan, err error) {
+	content, err := deps.readFile(filePath)
+	if err != nil {
+		return plan, err
+	}
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return plan, fmt.Errorf("parsing plan %q: %w", filePath, err)
+	}
+	if _, err := deps.linker(plan.LinkMode, nil); err != nil {
+		return plan, fmt.Errorf("plan %q: %w", filePath, err)
+	}
+	if plan.DeleteMethod == quarantineMethod && plan.Quarantine == "" {
+		return plan, fmt.Errorf("plan %q: the quarantine directory is missing", filePath)
+	}
+	for _, entry := range plan.Entries {
+		if !entry.links() && entry.Op != plan.DeleteMethod {
+			return plan, fmt.Errorf("plan %q: unexpected operation %q on %q", filePath, entry.Op, entry.Source)
+		}
+	}
+	return plan, nil
+}
+
+/*
+applyPlan re-validates every entry before performing it: drifted entries are reported and either skipped,
+along with the removal of their source, or abort the whole plan before anything is done.
+*/
+func applyPlan(plan Plan, onDrift string, report Reporter, journal *Journal, deps dependencies) (aborted bool) {
+	link, _ := deps.linker(plan.LinkMode, nil)
+	states := map[string]sourceState{}
+	stateErrs := map[string]error{}
+	drifts := make([]error, len(plan.Entries))
+	drifted := false
+	for i, entry := range plan.Entries {
+		if _, found := states[entry.Source]; !found {
+			states[entry.Source], stateErrs[entry.Source] = readSourceState(entry.Source, deps)
+		}
+		drifts[i] = entry.drift(states[entry.Source], stateErrs[entry.Source], deps)
+		drifted = drifted || drifts[i] != nil
+	}
+	if drifted && onDrift == abortOnDrift {
+		for i, entry := range plan.Entries {
+			if drifts[i] != nil {
+				report.Error(entry.Source, entry.target(), drifts[i])
+			}
+		}
+		return true
+	}
+	failed := fileset.New()
+	removable := fileset.New()
+	reported := fileset.New()
+	for i, entry := range plan.Entries {
+		if drifts[i] != nil {
+			report.Error(entry.Source, entry.target(), drifts[i])
+			failed.Add(entry.Source)
+			continue
+		}
+		if !entry.links() {
+			if _, found := failed[entry.Source]; !found {
+				removable.Add(entry.Source)
+				for _, kept := range entry.Keeps {
+					if err := journal.Kept(entry.Source, kept.Path); err != nil {
+						report.Error(entry.Source, kept.Path, err)
+					}
+				}
+			}
+			continue
+		}
+		// a source linked into several destinations is reported once
+		if _, found := reported[entry.Source]; !found {
+			reported.Add(entry.Source)
+			report.Source(entry.Source)
+		}
+		var err error
+		switch {
+		case entry.Op == replaceOp && !deps.alreadyLinked(entry.Source, entry.Destination):
+			err = deps.replaceWithLink(entry.Source, entry.Destination, link)
+		case entry.Op == linkOp:
+			if err = deps.mkdirAll(filepath.Dir(entry.Destination), 0o755); err == nil {
+				err = link(entry.Source, entry.Destination)
+			}
+		}
+		if err != nil {
+			report.Error(entry.Source, entry.Destination, err)
+			failed.Add(entry.Source)
+			continue
+		}
+		report.Linked(entry.Source, entry.Destination)
+		journaled := journal.Linked
+		// an identical file replaced by a link must survive an undo, so it's only restored from
+		if entry.Op == replaceOp {
+			journaled = journal.Kept
+		}
+		if err := journaled(entry.Source, entry.Destination); err != nil {
+			report.Error(entry.Source, entry.Destination, err)
+		}
+	}
+	switch plan.DeleteMethod {
+	case "trash":
+		tryTrash(removable, report, journal, deps)
+	case "delete":
+		tryDelete(removable, report, journal, deps)
+	case quarantineMethod:
+		quarantine := NewQuarantine(plan.Quarantine, plan.SourceDirectory, time.Now, deps)
+		defer quarantine.Close()
+		tryQuarantine(removable, report, journal, quarantine, deps)
+	}
+	return false
+}
+
+// planCommand implements the `plan` sub-command: `zl_cleanup plan -out PLAN [FLAGS]`, FLAGS being those of a dry run.
+func planCommand(args []string) {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	// the plan takes the flags of a job, along with its own
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		flags.Var(f.Value, f.Name, f.Usage)
+	})
+	out := flags.String("out", "", "file where to write the plan")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: zl_cleanup plan -out PLAN [FLAGS]")
+		flags.PrintDefaults()
+	}
+	config, errs := populateConfig(flags, args)
+	// the plan is checked as the run applying it
+	toApply := config
+	toApply.doRun = true
+	errs = append(errs, toApply.Errors()...)
+	if *out == "" {
+		errs = append(errs, errors.New("'out' is required"))
+	}
+	if config.doRun || config.interactive {
+		errs = append(errs, errors.New("a plan is made by a dry run: don't use 'run' nor 'interactive'"))
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Error parsing config:\n%v\n", errs)
+		os.Exit(exitConfigError)
+	}
+	deps := osDependencies()
+	plan, totals, aborted, errs, err := makePlan(config, deps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error planning:\n%v\n", err)
+		os.Exit(exitConfigError)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Error reading sources:\n%v\n", errs)
+		os.Exit(exitPartialFailure)
+	}
+	if aborted {
+		os.Exit(exitAborted)
+	}
+	if err := WritePlan(*out, plan, deps); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing plan:\n%v\n", err)
+		os.Exit(exitPartialFailure)
+	}
+	os.Exit(exitCode(totals, false))
+}
+
+// applyCommand implements the `apply` sub-command: `zl_cleanup apply [-on-drift skip|abort] PLAN`.
+func applyCommand(args []string) {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	onDrift := flags.String("on-drift", abortOnDrift, "when an entry drifted since planned: abort the whole plan, or skip it along with the removal of its source")
+	format := flags.String("format", textFormat, "report format: text, json or ndjson (streamed)")
+	journalPath := flags.String("journal", "", "file where to record the operations for 'undo'; defaults to $XDG_STATE_HOME/zl_cleanup/<timestamp>.jsonl")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: zl_cleanup apply [-on-drift skip|abort] [-format FORMAT] [-journal JOURNAL] PLAN")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || (*onDrift != skipOnDrift && *onDrift != abortOnDrift) {
+		flags.Usage()
+		os.Exit(exitConfigError)
+	}
+	if err := formatError(*format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flags.Usage()
+		os.Exit(exitConfigError)
+	}
+	deps := osDependencies()
+	plan, err := ReadPlan(flags.Arg(0), deps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading plan:\n%v\n", err)
+		os.Exit(exitConfigError)
+	}
+	if *journalPath == "" {
+		if *journalPath, err = defaultJournalPath(time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error locating the journal directory:\n%v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+	journal, err := OpenJournal(*journalPath, deps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening journal:\n%v\n", err)
+		os.Exit(exitConfigError)
+	}
+	report := NewReporter(Config{doRun: true, format: *format}, deps.stdout, deps.stderr)
+	aborted := applyPlan(plan, *onDrift, report, journal, deps)
+	report.Print()
+	journal.Close()
+	os.Exit(exitCode(report.Totals(), aborted))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func planFixture(t *testing.T) (source, destination string, plan Plan) {
+	t.Helper()
+	source, destination = t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"a (z-lib.org).pdf": "a",
+		"b (z-lib.org).pdf": "b",
+	})
+	plan, _, _, errs, err := makePlan(Config{
+		sourceDirectory:        source,
+		destinationDirectories: []string{destination},
+		rules:                  DefaultRuleSet(),
+		onConflict:             skipOnConflict,
+		onCollision:            disambiguateCollisions,
+		linkMode:               hardlinkMode,
+		deleteMethod:           "delete",
+		quiet:                  true,
+	}, osDependencies())
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	require.Len(t, plan.Entries, 4)
+	return
+}
+
+func TestPlanRoundTrip(t *testing.T) {
+	source, destination, plan := planFixture(t)
+	assert.NoFileExists(t, filepath.Join(destination, "a.pdf"), "planning is a dry run")
+
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, WritePlan(planPath, plan, osDependencies()))
+	read, err := ReadPlan(planPath, osDependencies())
+	require.NoError(t, err)
+	assert.Equal(t, plan.Entries[0].Hash, read.Entries[0].Hash)
+	assert.True(t, plan.Entries[0].ModTime.Equal(read.Entries[0].ModTime))
+
+	report := NewJSONReport(io.Discard, false)
+	applyPlan(read, abortOnDrift, report, nil, osDependencies())
+	assert.Equal(t, Totals{Sources: 2, Linked: 2, Deleted: 2}, report.Totals())
+	assert.FileExists(t, filepath.Join(destination, "a.pdf"))
+	assert.NoFileExists(t, filepath.Join(source, "a (z-lib.org).pdf"))
+}
+
+func TestApplyDriftedPlan(t *testing.T) {
+	source, destination, plan := planFixture(t)
+	require.NoError(t, os.WriteFile(filepath.Join(source, "b (z-lib.org).pdf"), []byte("b, revised"), 0o644))
+
+	report := NewJSONReport(io.Discard, false)
+	applyPlan(plan, abortOnDrift, report, nil, osDependencies())
+	assert.Equal(t, Totals{Errors: 2}, report.Totals(), "the link and the removal of b drifted")
+	assert.NoFileExists(t, filepath.Join(destination, "a.pdf"), "nothing is applied once aborted")
+
+	report = NewJSONReport(io.Discard, false)
+	applyPlan(plan, skipOnDrift, report, nil, osDependencies())
+	assert.Equal(t, Totals{Sources: 1, Linked: 1, Deleted: 1, Errors: 2}, report.Totals())
+	assert.FileExists(t, filepath.Join(destination, "a.pdf"))
+	assert.NoFileExists(t, filepath.Join(destination, "b.pdf"))
+	assert.FileExists(t, filepath.Join(source, "b (z-lib.org).pdf"), "a drifted source is kept")
+}
+
+func TestApplyPlanWithTakenDestination(t *testing.T) {
+	source, destination, plan := planFixture(t)
+	writeFiles(t, destination, map[string]string{"a.pdf": "someone else"})
+
+	report := NewJSONReport(io.Discard, false)
+	applyPlan(plan, skipOnDrift, report, nil, osDependencies())
+	assert.Equal(t, Totals{Sources: 1, Linked: 1, Deleted: 1, Errors: 1}, report.Totals())
+	content, err := os.ReadFile(filepath.Join(destination, "a.pdf"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal([]byte("someone else"), content))
+	assert.FileExists(t, filepath.Join(source, "a (z-lib.org).pdf"))
+}
+
+func TestApplyPlanIntoSeveralDestinations(t *testing.T) {
+	source, first, second := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{"a (z-lib.org).pdf": "a"})
+	plan, _, _, errs, err := makePlan(Config{
+		sourceDirectory:        source,
+		destinationDirectories: []string{first, second},
+		rules:                  DefaultRuleSet(),
+		onConflict:             skipOnConflict,
+		onCollision:            disambiguateCollisions,
+		linkMode:               hardlinkMode,
+		quiet:                  true,
+	}, osDependencies())
+	require.NoError(t, err)
+	require.Empty(t, errs)
+
+	report := NewJSONReport(io.Discard, false)
+	applyPlan(plan, abortOnDrift, report, nil, osDependencies())
+	assert.Equal(t, Totals{Sources: 1, Linked: 2}, report.Totals(), "the source is counted once")
+	assert.FileExists(t, filepath.Join(first, "a.pdf"))
+	assert.FileExists(t, filepath.Join(second, "a.pdf"))
+}
+
+func TestApplyPlanQuarantinesUnderTheSourceTree(t *testing.T) {
+	source, destination, quarantine := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"a (z-lib.org).pdf":     "a",
+		"sub/a (z-lib.org).pdf": "sub a",
+	})
+	plan, _, _, errs, err := makePlan(Config{
+		sourceDirectory:        source,
+		destinationDirectories: []string{destination},
+		rules:                  DefaultRuleSet(),
+		onConflict:             skipOnConflict,
+		onCollision:            disambiguateCollisions,
+		linkMode:               hardlinkMode,
+		deleteMethod:           quarantineMethod,
+		quarantineDirectory:    quarantine,
+		recursive:              true,
+		quiet:                  true,
+	}, osDependencies())
+	require.NoError(t, err)
+	require.Empty(t, errs)
+
+	report := NewJSONReport(io.Discard, false)
+	applyPlan(plan, abortOnDrift, report, nil, osDependencies())
+	assert.Equal(t, Totals{Sources: 2, Linked: 2, Quarantined: 2}, report.Totals())
+	batches, err := filepath.Glob(filepath.Join(quarantine, "*", "files"))
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	assert.FileExists(t, filepath.Join(batches[0], "a (z-lib.org).pdf"))
+	assert.FileExists(t, filepath.Join(batches[0], "sub", "a (z-lib.org).pdf"), "the sub-directory is kept, not flattened")
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recorder holds back the events of a file processed by a worker, to replay them in order once every preceding file is done.
+type recorder struct {
+	events []func(Reporter)
+}
+
+func (I *recorder) record(event func(Reporter)) {
+	I.events = append(I.events, event)
+}
+
+func (I *recorder) replay(report Reporter) {
+	for _, event := range I.events {
+		event(report)
+	}
+}
+
+func (I *recorder) Source(filePath string) {
+	I.record(func(r Reporter) { r.Source(filePath) })
+}
+
+func (I *recorder) Explain(dirtyName string, changes []Change) {
+	I.record(func(r Reporter) { r.Explain(dirtyName, changes) })
+}
+
+func (I *recorder) Adjusted(filePath, adjustment string) {
+	I.record(func(r Reporter) { r.Adjusted(filePath, adjustment) })
+}
+
+func (I *recorder) LinkPreview(oldPath, filePath string) {
+	I.record(func(r Reporter) { r.LinkPreview(oldPath, filePath) })
+}
+
+func (I *recorder) Linked(oldPath, filePath string) {
+	I.record(func(r Reporter) { r.Linked(oldPath, filePath) })
+}
+
+func (I *recorder) Homonym(oldPath, filePath string) {
+	I.record(func(r Reporter) { r.Homonym(oldPath, filePath) })
+}
+
+func (I *recorder) Skipped(oldPath, filePath string) {
+	I.record(func(r Reporter) { r.Skipped(oldPath, filePath) })
+}
+
+func (I *recorder) AlreadyInLibrary(oldPath, libraryPath string) {
+	I.record(func(r Reporter) { r.AlreadyInLibrary(oldPath, libraryPath) })
+}
+
+func (I *recorder) Collision(filePath string, oldPaths []string, resolution string) {
+	I.record(func(r Reporter) { r.Collision(filePath, oldPaths, resolution) })
+}
+
+func (I *recorder) UnlinkPreview(filePath string) {
+	I.record(func(r Reporter) { r.UnlinkPreview(filePath) })
+}
+
+func (I *recorder) Unlinked(filePath string) {
+	I.record(func(r Reporter) { r.Unlinked(filePath) })
+}
+
+func (I *recorder) Trashing(filePath string) {
+	I.record(func(r Reporter) { r.Trashing(filePath) })
+}
+
+func (I *recorder) Trashed(filePath string) {
+	I.record(func(r Reporter) { r.Trashed(filePath) })
+}
+
+func (I *recorder) Quarantined(oldPath, filePath string) {
+	I.record(func(r Reporter) { r.Quarantined(oldPath, filePath) })
+}
+
+func (I *recorder) Deleted(filePath string) {
+	I.record(func(r Reporter) { r.Deleted(filePath) })
+}
+
+func (I *recorder) Error(oldPath, filePath string, err error) {
+	I.record(func(r Reporter) { r.Error(oldPath, filePath, err) })
+}
+
+// Totals are counted by the reporter the events are replayed to.
+func (I *recorder) PurgePreview(batchPath string, age time.Duration) {
+	I.record(func(r Reporter) { r.PurgePreview(batchPath, age) })
+}
+
+func (I *recorder) Purged(batchPath string, age time.Duration) {
+	I.record(func(r Reporter) { r.Purged(batchPath, age) })
+}
+
+func (I *recorder) Totals() Totals {
+	return Totals{}
+}
+
+func (I *recorder) Print() {}
+
+/*
+pathLocks serializes the placement of files at paths that may end up being the same: on conflict a file is placed
+at "name (2).ext", where another file may be meant to go, so the lock is shared by every numeric suffix of a name,
+whatever its case, for case insensitive file systems.
+*/
+type pathLocks struct {
+	mutex sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newPathLocks() *pathLocks {
+	return &pathLocks{locks: map[string]*sync.Mutex{}}
+}
+
+var numericSuffixes = regexp.MustCompile(`(?: \(\d+\))+$`)
+
+// lockKey is filePath without any numeric suffix, lower case.
+func lockKey(filePath string) string {
+	ext := filepath.Ext(filePath)
+	stem := numericSuffixes.ReplaceAllString(strings.TrimSuffix(filePath, ext), "")
+	return strings.ToLower(stem + ext)
+}
+
+// lock blocks until no one else holds filePath, or any of its suffixed variants, returning the function releasing it.
+func (I *pathLocks) lock(filePath string) (unlock func()) {
+	key := lockKey(filePath)
+	I.mutex.Lock()
+	lock, found := I.locks[key]
+	if !found {
+		lock = &sync.Mutex{}
+		I.locks[key] = lock
+	}
+	I.mutex.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// cleanConcurrently applies the plan with I.jobs workers, reporting each file in order as soon as the ones before it are done.
+// Once 'max-errors' is reached no other file is started, those already started are still reported.
+func (I *job) cleanConcurrently(plan []*plannedFile, linked func(oldPath string)) {
+	type result struct {
+		linked  bool
+		skipped bool
+	}
+	done := make([]chan result, len(plan))
+	for i := range done {
+		done[i] = make(chan result, 1)
+	}
+	indexes := make(chan int)
+	stop := make(chan struct{})
+	for w := 0; w < I.jobs; w++ {
+		go func() {
+			for i := range indexes {
+				p := plan[i]
+				done[i] <- result{linked: p.valid && I.apply(p, &p.events)}
+			}
+		}()
+	}
+	// files started but not yet reported, bounding the work done after a stop
+	window := make(chan struct{}, 2*I.jobs)
+	go func() {
+		defer close(indexes)
+		for i := range plan {
+			select {
+			case window <- struct{}{}:
+				indexes <- i
+			case <-stop:
+				for ; i < len(plan); i++ {
+					done[i] <- result{skipped: true}
+				}
+				return
+			}
+		}
+	}()
+	stopped := false
+	for i, p := range plan {
+		res := <-done[i]
+		if res.skipped {
+			continue
+		}
+		<-window
+		p.events.replay(I.report)
+		if res.linked {
+			linked(p.oldPath)
+		}
+		if !stopped && I.tooManyErrors() {
+			stopped = true
+			close(stop)
+		}
+	}
+}
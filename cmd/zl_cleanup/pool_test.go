@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanConcurrently(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	contents := map[string]string{
+		"same (z-lib.org).pdf":  "one",
+		"same (Z-Library).pdf":  "two",
+		"same (z-lib.org).epub": "three",
+	}
+	for i := 0; i < 30; i++ {
+		contents[fmt.Sprintf("book %02d (z-lib.org).pdf", i)] = fmt.Sprint(i)
+	}
+	writeFiles(t, source, contents)
+
+	var out bytes.Buffer
+	job := newTestJob(t, Config{
+		sourceDirectory:        source,
+		destinationDirectories: []string{destination},
+		rules:                  DefaultRuleSet(),
+		onConflict:             suffixOnConflict,
+		doRun:                  true,
+		jobs:                   8,
+	}, &out)
+	linked := job.clean(testDirtyFiles(t, job))
+	job.report.Print()
+	assert.Len(t, linked, len(contents))
+
+	var sources []string
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var event Event
+		require.NoError(t, decoder.Decode(&event))
+		assert.NotEqual(t, "ERROR", event.Event, event.Error)
+		if event.Event == "SOURCE" {
+			sources = append(sources, event.Old)
+		}
+	}
+	assert.Len(t, sources, len(contents))
+	assert.True(t, sort.StringsAreSorted(sources), "the report follows the order of the source paths")
+
+	for _, name := range []string{"same.pdf", "same (2).pdf", "same.epub"} {
+		assert.FileExists(t, filepath.Join(destination, name))
+	}
+	entries, err := os.ReadDir(destination)
+	require.NoError(t, err)
+	assert.Len(t, entries, len(contents))
+}
+
+func TestLockKey(t *testing.T) {
+	assert.Equal(t, lockKey("/out/X.pdf"), lockKey("/out/X (2).pdf"))
+	assert.Equal(t, lockKey("/out/X.pdf"), lockKey("/out/x (2) (3).pdf"))
+	assert.NotEqual(t, lockKey("/out/X.pdf"), lockKey("/out/X.epub"))
+	assert.NotEqual(t, lockKey("/out/X.pdf"), lockKey("/other/X (2).pdf"))
+	assert.NotEqual(t, lockKey("/out/X (draft).pdf"), lockKey("/out/X.pdf"))
+}
+
+func TestSuffixedNamesArePlacedOneAtATime(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"X (z-lib.org).pdf":     "x",
+		"X (2) (z-lib.org).pdf": "x, the second",
+	})
+	writeFiles(t, destination, map[string]string{"X.pdf": "another x"})
+	var inFlight atomic.Int32
+	var overlapped atomic.Bool
+	link := func(oldPath, newPath string) error {
+		if inFlight.Add(1) > 1 {
+			overlapped.Store(true)
+		}
+		defer inFlight.Add(-1)
+		time.Sleep(10 * time.Millisecond)
+		return os.Link(oldPath, newPath)
+	}
+
+	var out bytes.Buffer
+	job := newTestJob(t, Config{
+		sourceDirectory:        source,
+		destinationDirectories: []string{destination},
+		rules:                  DefaultRuleSet(),
+		onConflict:             suffixOnConflict,
+		doRun:                  true,
+		jobs:                   2,
+	}, &out)
+	job.link = link
+	linked := job.clean(testDirtyFiles(t, job))
+
+	assert.Len(t, linked, 2)
+	assert.Zero(t, job.report.Totals().Errors, out.String())
+	assert.False(t, overlapped.Load(), "'X' placed as 'X (2)' may take the name of 'X (2)'")
+	entries, err := os.ReadDir(destination)
+	require.NoError(t, err)
+	var contents []string
+	for _, e := range entries {
+		content, err := os.ReadFile(filepath.Join(destination, e.Name()))
+		require.NoError(t, err)
+		contents = append(contents, string(content))
+	}
+	assert.ElementsMatch(t, []string{"another x", "x", "x, the second"}, contents)
+}
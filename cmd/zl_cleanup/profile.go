@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/exp/slices"
+)
+
+/*
+A config file holds named profiles, each one setting the command-line flags of a recurring job,
+with the same names and values; for example:
+
+	[profile.daily]
+	source = "~/Downloads"
+	destination = ["~/Books", "/Volumes/nas/books"]
+	trash = true
+	rules = "~/.config/zl_cleanup/rules.toml"
+	format = "ndjson"
+	recursive = true
+	exclude = ["*.part", ".*"]
+
+Flags given on the command line override the values of the profile.
+*/
+
+// Profile maps flag names to their values.
+type Profile map[string]any
+
+// flags that make no sense in a profile
+var notInProfile = map[string]bool{"config": true, "profile": true, "justconfig": true}
+
+// exclusiveFlags are sets of flags where, if any is given on the command line, the profile can't set the others.
+var exclusiveFlags = [][]string{{"trash", "delete", "quarantine"}}
+
+const (
+	defaultOrigin     = "default"
+	commandLineOrigin = "command line"
+)
+
+func defaultConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "zl_cleanup", "config.toml")
+}
+
+func LoadProfile(configPath, name string) (Profile, error) {
+	f, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var configFile struct {
+		Profile map[string]Profile `toml:"profile"`
+	}
+	if err := toml.NewDecoder(f).Decode(&configFile); err != nil {
+		return nil, fmt.Errorf("parsing config file %q: %w", configPath, err)
+	}
+	profile, found := configFile.Profile[name]
+	if !found {
+		return nil, fmt.Errorf("profile %q not found in %q", name, configPath)
+	}
+	return profile, nil
+}
+
+// expandHome replaces a leading "~/" with the home directory of the user.
+func expandHome(value string) string {
+	if !strings.HasPrefix(value, "~/") {
+		return value
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return value
+	}
+	return filepath.Join(home, value[2:])
+}
+
+// applyProfile sets, on flags already parsed, the values of the profile for all the flags not given on the command line;
+// it returns the origin of each flag value.
+func applyProfile(flags *flag.FlagSet, profile Profile, profileName string) (origins map[string]string, errs []error) {
+	origins = map[string]string{}
+	flags.VisitAll(func(f *flag.Flag) {
+		origins[f.Name] = defaultOrigin
+	})
+	flags.Visit(func(f *flag.Flag) {
+		origins[f.Name] = commandLineOrigin
+	})
+	overridden := func(name string) bool {
+		for _, exclusive := range exclusiveFlags {
+			if !slices.Contains(exclusive, name) {
+				continue
+			}
+			for _, other := range exclusive {
+				if origins[other] == commandLineOrigin {
+					return true
+				}
+			}
+		}
+		return origins[name] == commandLineOrigin
+	}
+	names := make([]string, 0, len(profile))
+	for name := range profile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	profileOrigin := fmt.Sprintf("profile %q", profileName)
+	for _, name := range names {
+		if flags.Lookup(name) == nil || notInProfile[name] {
+			errs = append(errs, fmt.Errorf("profile %q: unknown setting %q", profileName, name))
+			continue
+		}
+		if overridden(name) {
+			continue
+		}
+		var values []any
+		switch value := profile[name].(type) {
+		case []any:
+			values = value
+		default:
+			values = []any{value}
+		}
+		for _, value := range values {
+			text := fmt.Sprint(value)
+			if s, isString := value.(string); isString {
+				text = expandHome(s)
+			}
+			if err := flags.Set(name, text); err != nil {
+				errs = append(errs, fmt.Errorf("profile %q: %s: %w", profileName, name, err))
+			}
+		}
+		origins[name] = profileOrigin
+	}
+	return
+}
+
+// printFlags writes the final value of every flag along with where it comes from.
+func printFlags(w io.Writer, flags *flag.FlagSet, origins map[string]string) {
+	flags.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(w, "-%s=%s\t(%s)\n", f.Name, f.Value.String(), origins[f.Name])
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyProfile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	content := `
+[profile.daily]
+source = "/downloads"
+destination = ["/books", "/nas/books"]
+trash = true
+format = "ndjson"
+recursive = true
+`
+	require.NoError(t, os.WriteFile(configPath, []byte(content), 0o644))
+	profile, err := LoadProfile(configPath, "daily")
+	require.NoError(t, err)
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	source := flags.String("source", "", "")
+	destinations := new(destinations)
+	flags.Var(destinations, "destination", "")
+	trash := flags.Bool("trash", false, "")
+	remove := flags.Bool("delete", false, "")
+	format := flags.String("format", textFormat, "")
+	recursive := flags.Bool("recursive", false, "")
+	flags.Bool("quiet", false, "")
+	require.NoError(t, flags.Parse([]string{"-format", "json", "-delete"}))
+
+	origins, errs := applyProfile(flags, profile, "daily")
+
+	require.Empty(t, errs)
+	assert.Equal(t, "/downloads", *source)
+	assert.Equal(t, []string{"/books", "/nas/books"}, []string(*destinations))
+	assert.Equal(t, "json", *format, "command line flags override the profile")
+	assert.True(t, *remove)
+	assert.False(t, *trash, "'delete' given on the command line excludes 'trash'")
+	assert.True(t, *recursive)
+
+	var out bytes.Buffer
+	printFlags(&out, flags, origins)
+	assert.Equal(t, `-delete=true	(command line)
+-destination=/books:/nas/books	(profile "daily")
+-format=json	(command line)
+-quiet=false	(default)
+-recursive=true	(profile "daily")
+-source=/downloads	(profile "daily")
+-trash=false	(default)
+`, out.String())
+}
+
+func TestApplyProfileRejectsUnknownSettings(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("profile", "", "")
+	_, errs := applyProfile(flags, Profile{"sorce": "/downloads", "profile": "other"}, "daily")
+	assert.Len(t, errs, 2)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dev.acorello.it/go/arkivist/cmd/zl_cleanup/fileset"
+)
+
+/*
+A quarantine directory holds the sources removed by each run in a batch folder named after its start time:
+
+	QUARANTINE/20261018T103311.000000000/files/<source relative path>
+	QUARANTINE/20261018T103311.000000000/manifest.jsonl
+
+until `zl_cleanup purge` deletes the batches older than a given age.
+*/
+
+const (
+	quarantineMethod    = "quarantine"
+	quarantineBatchTime = "20060102T150405.000000000"
+	quarantineManifest  = "manifest.jsonl"
+)
+
+// QuarantineEntry is a manifest line, telling where a source was moved.
+type QuarantineEntry struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Path   string    `json:"path"`
+	Size   int64     `json:"size"`
+	Hash   string    `json:"sha256"`
+}
+
+// Quarantine moves files into a batch folder, created on the first move.
+type Quarantine struct {
+	batch string
+	// sourceDirectory, when given, is the root of the relative paths the files are quarantined at
+	sourceDirectory string
+	now             func() time.Time
+	manifest        appendFile
+	deps            dependencies
+}
+
+func NewQuarantine(dir, sourceDirectory string, now func() time.Time, deps dependencies) *Quarantine {
+	return &Quarantine{
+		batch:           filepath.Join(dir, now().Format(quarantineBatchTime)),
+		sourceDirectory: sourceDirectory,
+		now:             now,
+		deps:            deps,
+	}
+}
+
+// quarantinePath is where filePath goes in the batch: at its path relative to the source directory, else by name.
+func (I *Quarantine) quarantinePath(filePath string) string {
+	relPath := filepath.Base(filePath)
+	if I.sourceDirectory != "" {
+		if rel, err := filepath.Rel(I.sourceDirectory, filePath); err == nil && !strings.HasPrefix(rel, "..") {
+			relPath = rel
+		}
+	}
+	return filepath.Join(I.batch, "files", relPath)
+}
+
+// Move quarantines filePath, copying it when the quarantine is on another file system, and records it in the manifest.
+func (I *Quarantine) Move(filePath string) (string, error) {
+	if I.manifest == nil {
+		if err := I.deps.mkdirAll(I.batch, 0o755); err != nil {
+			return "", err
+		}
+		manifest, err := I.deps.appendTo(filepath.Join(I.batch, quarantineManifest))
+		if err != nil {
+			return "", err
+		}
+		I.manifest = manifest
+	}
+	hash, err := I.deps.hash(filePath)
+	if err != nil {
+		return "", err
+	}
+	info, err := I.deps.stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	target := I.quarantinePath(filePath)
+	for n := 2; I.deps.fileExists(target); n++ {
+		target = suffixedPath(I.quarantinePath(filePath), n)
+	}
+	if err := I.deps.mkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	if err := I.deps.rename(filePath, target); isCrossDevice(err) {
+		if err := I.deps.copy(filePath, target); err != nil {
+			return "", err
+		}
+		if err := I.deps.remove(filePath); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+	line, err := json.Marshal(QuarantineEntry{Time: I.now(), Source: filePath, Path: target, Size: info.Size(), Hash: hex.EncodeToString(hash)})
+	if err != nil {
+		return target, err
+	}
+	if _, err := I.manifest.Write(append(line, '\n')); err != nil {
+		return target, fmt.Errorf("writing manifest: %w", err)
+	}
+	return target, I.manifest.Sync()
+}
+
+func (I *Quarantine) Close() error {
+	if I == nil || I.manifest == nil {
+		return nil
+	}
+	return I.manifest.Close()
+}
+
+func tryQuarantine(movedFiles fileset.FileSet, report Reporter, journal *Journal, quarantine *Quarantine, deps dependencies) {
+	for _, fileName := range movedFiles.Sorted() {
+		report.Trashing(fileName)
+		id, _ := deps.statFileID(fileName)
+		quarantined, err := quarantine.Move(fileName)
+		if quarantined == "" {
+			report.Error(fileName, fileName, err)
+			continue
+		}
+		report.Quarantined(fileName, quarantined)
+		if err == nil {
+			err = journal.Removed(fileName, quarantineMethod, id)
+		}
+		if err != nil {
+			report.Error(fileName, quarantined, err)
+		}
+	}
+}
+
+// quarantineBatch is a batch folder, along with the time it was started at.
+type quarantineBatch struct {
+	path    string
+	started time.Time
+}
+
+// quarantineBatches lists the batches in dir, oldest first; other entries are ignored.
+func quarantineBatches(dir string, deps dependencies) (batches []quarantineBatch, err error) {
+	entries, err := deps.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		started, err := time.ParseInLocation(quarantineBatchTime, entry.Name(), time.Local)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		batches = append(batches, quarantineBatch{path: filepath.Join(dir, entry.Name()), started: started})
+	}
+	sort.Slice(batches, func(i, j int) bool { return batches[i].started.Before(batches[j].started) })
+	return
+}
+
+// age is a flag.Value accepting a duration as time.ParseDuration does, or a number of days like "30d".
+type age time.Duration
+
+func (me *age) String() string {
+	if me == nil {
+		return ""
+	}
+	d := time.Duration(*me)
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+func (me *age) Set(value string) error {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid number of days %q", value)
+		}
+		*me = age(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return errors.New("age can't be negative")
+	}
+	*me = age(d)
+	return nil
+}
+
+/*
+purge deletes, unless it's a dry run, the batches in dir started before cutoff, returning those that are, or would be, deleted;
+the batches that can't be deleted are reported as errors.
+*/
+func purge(dir string, cutoff time.Time, dryRun bool, report Reporter, deps dependencies) (purged []quarantineBatch) {
+	batches, err := quarantineBatches(dir, deps)
+	if err != nil {
+		report.Error(dir, dir, err)
+		return nil
+	}
+	for _, batch := range batches {
+		if !batch.started.Before(cutoff) {
+			continue
+		}
+		if !dryRun {
+			if err := deps.removeAll(batch.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				report.Error(batch.path, batch.path, err)
+				continue
+			}
+		}
+		purged = append(purged, batch)
+	}
+	return
+}
+
+// purgeCommand implements the `purge` sub-command: `zl_cleanup purge [-run] [-older-than AGE] [-format FORMAT] QUARANTINE`.
+func purgeCommand(args []string) {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	doRun := flags.Bool("run", false, "execute the operation")
+	olderThan := age(30 * 24 * time.Hour)
+	flags.Var(&olderThan, "older-than", "purge the batches started longer ago than this, e.g. '30d' or '12h'")
+	format := flags.String("format", textFormat, "report format: text, json or ndjson (streamed)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: zl_cleanup purge [-run] [-older-than AGE] [-format FORMAT] QUARANTINE")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(exitConfigError)
+	}
+	if err := formatError(*format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flags.Usage()
+		os.Exit(exitConfigError)
+	}
+	deps := osDependencies()
+	report := NewReporter(Config{doRun: *doRun, format: *format}, deps.stdout, deps.stderr)
+	now := time.Now()
+	for _, batch := range purge(flags.Arg(0), now.Add(-time.Duration(olderThan)), !*doRun, report, deps) {
+		age := now.Sub(batch.started).Truncate(time.Minute)
+		if *doRun {
+			report.Purged(batch.path, age)
+		} else {
+			report.PurgePreview(batch.path, age)
+		}
+	}
+	report.Print()
+	os.Exit(exitCode(report.Totals(), false))
+}
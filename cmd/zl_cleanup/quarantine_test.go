@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dev.acorello.it/go/arkivist/cmd/zl_cleanup/fileset"
+)
+
+func TestQuarantine(t *testing.T) {
+	source, dir := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"a (z-lib.org).pdf":     "a",
+		"sub/a (z-lib.org).pdf": "sub a",
+	})
+	started := time.Date(2026, 10, 18, 10, 33, 11, 0, time.Local)
+	quarantine := NewQuarantine(dir, source, func() time.Time { return started }, osDependencies())
+	files := fileset.New()
+	files.Add(filepath.Join(source, "a (z-lib.org).pdf"))
+	files.Add(filepath.Join(source, "sub/a (z-lib.org).pdf"))
+	report := NewJSONReport(io.Discard, false)
+	tryQuarantine(files, report, nil, quarantine, osDependencies())
+	require.NoError(t, quarantine.Close())
+	assert.Equal(t, Totals{Quarantined: 2}, report.Totals())
+
+	batch := filepath.Join(dir, "20261018T103311.000000000")
+	assert.NoFileExists(t, filepath.Join(source, "a (z-lib.org).pdf"))
+	assert.FileExists(t, filepath.Join(batch, "files", "a (z-lib.org).pdf"))
+	assert.FileExists(t, filepath.Join(batch, "files", "sub", "a (z-lib.org).pdf"))
+
+	manifest, err := os.Open(filepath.Join(batch, quarantineManifest))
+	require.NoError(t, err)
+	defer manifest.Close()
+	var entries []QuarantineEntry
+	for scanner := bufio.NewScanner(manifest); scanner.Scan(); {
+		var entry QuarantineEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, filepath.Join(source, "a (z-lib.org).pdf"), entries[0].Source)
+	assert.Equal(t, int64(1), entries[0].Size)
+	assert.Equal(t, "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb", entries[0].Hash)
+}
+
+func TestPurge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	old := now.Add(-40 * 24 * time.Hour).Format(quarantineBatchTime)
+	recent := now.Add(-2 * 24 * time.Hour).Format(quarantineBatchTime)
+	writeFiles(t, dir, map[string]string{
+		old + "/files/a.pdf":    "a",
+		recent + "/files/b.pdf": "b",
+		"unrelated/c.pdf":       "c",
+	})
+	var olderThan age
+	require.NoError(t, olderThan.Set("30d"))
+	cutoff := now.Add(-time.Duration(olderThan))
+
+	report := NewJSONReport(io.Discard, false)
+	purged := purge(dir, cutoff, true, report, osDependencies())
+	require.Len(t, purged, 1)
+	assert.DirExists(t, filepath.Join(dir, old), "a dry run deletes nothing")
+
+	purged = purge(dir, cutoff, false, report, osDependencies())
+	assert.Zero(t, report.Totals().Errors)
+	require.Len(t, purged, 1)
+	assert.Equal(t, filepath.Join(dir, old), purged[0].path)
+	assert.NoDirExists(t, filepath.Join(dir, old))
+	assert.DirExists(t, filepath.Join(dir, recent))
+	assert.DirExists(t, filepath.Join(dir, "unrelated"))
+}
+
+func TestAgeFlag(t *testing.T) {
+	var a age
+	require.NoError(t, a.Set("12h"))
+	assert.Equal(t, 12*time.Hour, time.Duration(a))
+	require.NoError(t, a.Set("7d"))
+	assert.Equal(t, "7d", a.String())
+	assert.Error(t, a.Set("-1d"))
+	assert.Error(t, a.Set("soon"))
+}
+
+func TestQuarantineMovesAcrossFileSystems(t *testing.T) {
+	source, dir := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{"a (z-lib.org).pdf": "a", "b (z-lib.org).pdf": "b"})
+	deps := osDependencies()
+	var renameErr error
+	deps.rename = func(oldPath, newPath string) error {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: renameErr}
+	}
+	started := time.Date(2026, 10, 18, 10, 33, 11, 0, time.Local)
+	quarantine := NewQuarantine(dir, source, func() time.Time { return started }, deps)
+	defer quarantine.Close()
+	batch := filepath.Join(dir, "20261018T103311.000000000", "files")
+
+	renameErr = syscall.EXDEV
+	moved, err := quarantine.Move(filepath.Join(source, "a (z-lib.org).pdf"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(batch, "a (z-lib.org).pdf"), moved)
+	assert.FileExists(t, moved, "a rename across file systems falls back to a copy")
+	assert.NoFileExists(t, filepath.Join(source, "a (z-lib.org).pdf"))
+
+	renameErr = syscall.EPERM
+	_, err = quarantine.Move(filepath.Join(source, "b (z-lib.org).pdf"))
+	assert.ErrorIs(t, err, syscall.EPERM)
+	assert.FileExists(t, filepath.Join(source, "b (z-lib.org).pdf"), "any other failure keeps the source")
+}
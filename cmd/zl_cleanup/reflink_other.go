@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func cloneFile(src, dst *os.File) error {
+	return errors.New("reflink not supported on this platform")
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Reporter receives an event for every step of a job, and renders them when printed.
+type Reporter interface {
+	Source(filePath string)
+	Explain(dirtyName string, changes []Change)
+	// Adjusted tells the clean name had to be changed to fit the destination file system.
+	Adjusted(filePath, adjustment string)
+	LinkPreview(oldPath, filePath string)
+	Linked(oldPath, filePath string)
+	Homonym(oldPath, filePath string)
+	// AlreadyInLibrary tells the destination already holds the content of the source at oldPath, as libraryPath.
+	AlreadyInLibrary(oldPath, libraryPath string)
+	// Skipped tells filePath holds a different file, kept as the skip conflict policy says, so the source at oldPath stays.
+	Skipped(oldPath, filePath string)
+	// Collision tells the sources would all be placed at filePath, and how that was resolved.
+	Collision(filePath string, oldPaths []string, resolution string)
+	UnlinkPreview(filePath string)
+	Unlinked(filePath string)
+	Trashing(filePath string)
+	Trashed(filePath string)
+	// Quarantined tells the source at oldPath was moved to filePath, in the quarantine.
+	Quarantined(oldPath, filePath string)
+	Deleted(filePath string)
+	// PurgePreview and Purged tell the quarantine batch at batchPath, started age ago, is to be, or has been, deleted.
+	PurgePreview(batchPath string, age time.Duration)
+	Purged(batchPath string, age time.Duration)
+	Error(oldPath, filePath string, err error)
+	Totals() Totals
+	// Print flushes the report, after which no further event is expected.
+	Print()
+}
+
+const (
+	textFormat   = "text"
+	jsonFormat   = "json"
+	ndjsonFormat = "ndjson"
+)
+
+// formatError tells if format is not one NewReporter knows.
+func formatError(format string) error {
+	switch format {
+	case textFormat, jsonFormat, ndjsonFormat:
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// NewReporter returns the reporter of config's format; only the text report writes errors apart, to stderr.
+func NewReporter(config Config, stdout, stderr io.Writer) Reporter {
+	switch config.format {
+	case jsonFormat:
+		return NewJSONReport(stdout, config.quiet)
+	case ndjsonFormat:
+		return NewNDJSONReport(stdout, config.quiet)
+	default:
+		summary := NewSummary(config)
+		summary.stdout, summary.stderr = stdout, stderr
+		return &summary
+	}
+}
+
+type Totals struct {
+	Sources     int `json:"sources"`
+	Linked      int `json:"linked"`
+	Homonyms    int `json:"homonyms"`
+	Skipped     int `json:"skipped"`
+	Collisions  int `json:"collisions"`
+	Duplicates  int `json:"duplicates"`
+	Unlinked    int `json:"unlinked"`
+	Trashed     int `json:"trashed"`
+	Quarantined int `json:"quarantined"`
+	Deleted     int `json:"deleted"`
+	Purged      int `json:"purged"`
+	Errors      int `json:"errors"`
+}
+
+var (
+	errNameUnchanged = errors.New("name hasn't changed")
+	errInvalidRunes  = errors.New("found offensive runes")
+)
+
+// errorKind classifies err with a stable identifier meant for scripts.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, errNameUnchanged):
+		return "name-unchanged"
+	case errors.Is(err, errInvalidRunes):
+		return "invalid-runes"
+	case errors.Is(err, errReservedName):
+		return "reserved-name"
+	case errors.Is(err, errDrifted):
+		return "drifted"
+	case errors.Is(err, errConflict):
+		return "conflict"
+	case errors.Is(err, fs.ErrExist):
+		return "exists"
+	case errors.Is(err, fs.ErrNotExist):
+		return "not-found"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission"
+	case errors.Is(err, syscall.EXDEV):
+		return "cross-device"
+	default:
+		return "other"
+	}
+}
+
+// Summary is the colored, human readable report; it collects the output and prints it only at the end.
+type Summary struct {
+	out    strings.Builder
+	err    strings.Builder
+	stdout io.Writer
+	stderr io.Writer
+	totals Totals
+	Config
+}
+
+func (I *Summary) Totals() Totals {
+	return I.totals
+}
+
+func (I *Summary) fmtSummary(format string, a ...any) {
+	if I.quiet {
+		return
+	}
+	I.out.WriteString(fmt.Sprintf(format, a...))
+}
+
+func (I *Summary) fmtErr(format string, a ...any) {
+	if I.quiet {
+		return
+	}
+	I.err.WriteString(fmt.Sprintf(format, a...))
+}
+
+func (I *Summary) Entry(header, dirPath, fileName string) {
+	header = color.GreenString(header + ":")
+	I.fmtSummary("%s %s\n\t%s\n", header, dirPath, fileName)
+}
+func (I *Summary) Source(filePath string) {
+	I.totals.Sources++
+	fileName := filepath.Base(filePath)
+	fileName = color.HiGreenString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.GreenString("%s", dirPath)
+	I.Entry("SOURCE", dirPath, fileName)
+}
+func (I *Summary) Adjusted(filePath, adjustment string) {
+	fileName := filepath.Base(filePath)
+	fileName = color.HiMagentaString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.MagentaString("%s", dirPath)
+	I.Entry("ADJUSTED", dirPath, fileName+"\n\t"+adjustment)
+}
+
+func (I *Summary) LinkPreview(oldPath, filePath string) {
+	fileName := filepath.Base(filePath)
+	fileName = color.HiWhiteString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.WhiteString("%s", dirPath)
+	I.Entry("LINK??", dirPath, fileName)
+}
+func (I *Summary) Linked(oldPath, filePath string) {
+	I.totals.Linked++
+	fileName := filepath.Base(filePath)
+	fileName = color.HiCyanString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.CyanString("%s", dirPath)
+	I.Entry("LINKED", dirPath, fileName)
+}
+
+func (I *Summary) Homonym(oldPath, filePath string) {
+	I.totals.Homonyms++
+	fileName := filepath.Base(filePath)
+	fileName = color.HiBlueString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.BlueString("%s", dirPath)
+	I.Entry("HMONYM", dirPath, fileName)
+}
+
+func (I *Summary) Skipped(oldPath, filePath string) {
+	I.totals.Skipped++
+	fileName := color.HiYellowString("%s", filepath.Base(filePath))
+	dirPath := color.YellowString("%s", filepath.Dir(filePath))
+	header := color.YellowString("SKIPPED:")
+	I.fmtErr("%s %s\n\t%s\n\tkept, %s than %s\n", header, dirPath, fileName, errConflict, oldPath)
+}
+
+func (I *Summary) AlreadyInLibrary(oldPath, libraryPath string) {
+	I.totals.Duplicates++
+	fileName := color.HiBlueString("%s", filepath.Base(oldPath))
+	dirPath := color.BlueString("%s", filepath.Dir(oldPath))
+	I.Entry("DUPLICATE", dirPath, fileName+"\n\tALREADY IN LIBRARY at "+libraryPath)
+}
+
+func (I *Summary) Collision(filePath string, oldPaths []string, resolution string) {
+	I.totals.Collisions++
+	fileName := color.HiRedString("%s", filepath.Base(filePath))
+	dirPath := color.RedString("%s", filepath.Dir(filePath))
+	sources := make([]string, len(oldPaths))
+	for i, oldPath := range oldPaths {
+		sources[i] = "\t\t" + oldPath
+	}
+	header := color.RedString("COLLISION:")
+	I.fmtErr("%s %s\n\t%s (%s)\n%s\n", header, dirPath, fileName, resolution, strings.Join(sources, "\n"))
+}
+
+func (I *Summary) UnlinkPreview(filePath string) {
+	fileName := filepath.Base(filePath)
+	fileName = color.HiWhiteString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.WhiteString("%s", dirPath)
+	I.Entry("UNLINK??", dirPath, fileName)
+}
+
+func (I *Summary) Unlinked(filePath string) {
+	I.totals.Unlinked++
+	fileName := filepath.Base(filePath)
+	fileName = color.HiCyanString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.CyanString("%s", dirPath)
+	I.Entry("UNLINKED", dirPath, fileName)
+}
+
+func (I *Summary) Explain(dirtyName string, changes []Change) {
+	header := color.MagentaString("EXPLAIN:")
+	I.fmtSummary("%s %s\n", header, dirtyName)
+	for _, c := range changes {
+		matches := make([]string, len(c.Matches))
+		for i, m := range c.Matches {
+			matches[i] = fmt.Sprintf("%q", m)
+		}
+		I.fmtSummary("\t%s %s\n\t\t%s\n", color.HiMagentaString(c.Rule), strings.Join(matches, ", "), c.After)
+	}
+}
+
+func (I *Summary) Trashing(filePath string) {
+	fileName := filepath.Base(filePath)
+	fileName = color.HiYellowString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.YellowString("%s", dirPath)
+	I.Entry("TRASHING", dirPath, fileName)
+}
+
+func (I *Summary) Trashed(filePath string) {
+	I.totals.Trashed++
+	fileName := filepath.Base(filePath)
+	fileName = color.HiYellowString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.YellowString("%s", dirPath)
+	I.Entry("TRASHED", dirPath, fileName)
+}
+
+func (I *Summary) Quarantined(oldPath, filePath string) {
+	I.totals.Quarantined++
+	fileName := filepath.Base(filePath)
+	fileName = color.HiYellowString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.YellowString("%s", dirPath)
+	I.Entry("QUARANTINED", dirPath, fileName)
+}
+
+func (I *Summary) Deleted(filePath string) {
+	I.totals.Deleted++
+	fileName := filepath.Base(filePath)
+	fileName = color.HiYellowString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.YellowString("%s", dirPath)
+	I.Entry("DELETED", dirPath, fileName)
+}
+
+func (I *Summary) PurgePreview(batchPath string, age time.Duration) {
+	batchName := color.HiWhiteString("%s, %s old", filepath.Base(batchPath), age)
+	dirPath := color.WhiteString("%s", filepath.Dir(batchPath))
+	I.Entry("PURGE??", dirPath, batchName)
+}
+
+func (I *Summary) Purged(batchPath string, age time.Duration) {
+	I.totals.Purged++
+	batchName := color.HiYellowString("%s, %s old", filepath.Base(batchPath), age)
+	dirPath := color.YellowString("%s", filepath.Dir(batchPath))
+	I.Entry("PURGED", dirPath, batchName)
+}
+
+func (I *Summary) Error(oldPath, filePath string, err error) {
+	I.totals.Errors++
+	fileName := filepath.Base(filePath)
+	fileName = color.RedString("%s", fileName)
+	dirPath := filepath.Dir(filePath)
+	dirPath = color.RedString("%s", dirPath)
+	errMessage := color.HiRedString(err.Error())
+	header := color.RedString("ERROR:")
+	I.fmtErr("%s %s\n\t%s\n\t%s\n", header, dirPath, fileName, errMessage)
+}
+
+func (I *Summary) Len() int {
+	return I.out.Len() + I.err.Len()
+}
+
+func (I *Summary) Print() {
+	if !I.quiet && I.Len() == 0 {
+		I.fmtSummary("Nothing to report\n")
+	}
+	fmt.Fprint(I.stdout, I.out.String())
+	fmt.Fprint(I.stderr, I.err.String())
+}
+
+func NewSummary(config Config) Summary {
+	return Summary{
+		Config: config,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+}
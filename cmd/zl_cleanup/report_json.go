@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+)
+
+// Event is the structured form of a report entry.
+type Event struct {
+	Event   string   `json:"event"`
+	Old     string   `json:"old,omitempty"`
+	New     string   `json:"new,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Kind    string   `json:"kind,omitempty"`
+	Detail  string   `json:"detail,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+	Sources []string `json:"sources,omitempty"`
+	Totals  *Totals  `json:"totals,omitempty"`
+}
+
+// JSONReport emits the events either as they happen, one JSON object per line (NDJSON),
+// or all at once as a single JSON document when printed.
+type JSONReport struct {
+	encoder   *json.Encoder
+	streaming bool
+	quiet     bool
+	events    []Event
+	totals    Totals
+	// failed is set once the report can't be written, after which nothing else is
+	failed bool
+}
+
+func (I *JSONReport) Totals() Totals {
+	return I.totals
+}
+
+// NewJSONReport buffers the events and writes `{"events": [...], "totals": {...}}` when printed.
+func NewJSONReport(w io.Writer, quiet bool) *JSONReport {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return &JSONReport{encoder: encoder, quiet: quiet, events: []Event{}}
+}
+
+// NewNDJSONReport writes each event as soon as it happens and a final TOTALS event when printed.
+func NewNDJSONReport(w io.Writer, quiet bool) *JSONReport {
+	return &JSONReport{encoder: json.NewEncoder(w), streaming: true, quiet: quiet}
+}
+
+func (I *JSONReport) emit(event Event) {
+	if I.quiet {
+		return
+	}
+	if !I.streaming {
+		I.events = append(I.events, event)
+		return
+	}
+	I.encode(event)
+}
+
+// encode writes v; a failure is logged, and counted as an error, only once.
+func (I *JSONReport) encode(v any) {
+	if I.failed {
+		return
+	}
+	if err := I.encoder.Encode(v); err != nil {
+		I.failed = true
+		I.totals.Errors++
+		log.Printf("writing report: %s", err)
+	}
+}
+
+func (I *JSONReport) Source(filePath string) {
+	I.totals.Sources++
+	I.emit(Event{Event: "SOURCE", Old: filePath})
+}
+
+func (I *JSONReport) Explain(dirtyName string, changes []Change) {
+	I.emit(Event{Event: "EXPLAIN", Old: dirtyName, Changes: changes})
+}
+
+func (I *JSONReport) Adjusted(filePath, adjustment string) {
+	I.emit(Event{Event: "ADJUSTED", New: filePath, Detail: adjustment})
+}
+
+func (I *JSONReport) LinkPreview(oldPath, filePath string) {
+	I.emit(Event{Event: "LINK_PREVIEW", Old: oldPath, New: filePath})
+}
+
+func (I *JSONReport) Linked(oldPath, filePath string) {
+	I.totals.Linked++
+	I.emit(Event{Event: "LINKED", Old: oldPath, New: filePath})
+}
+
+func (I *JSONReport) Homonym(oldPath, filePath string) {
+	I.totals.Homonyms++
+	I.emit(Event{Event: "HOMONYM", Old: oldPath, New: filePath})
+}
+
+func (I *JSONReport) Skipped(oldPath, filePath string) {
+	I.totals.Skipped++
+	I.emit(Event{Event: "SKIPPED", Old: oldPath, New: filePath, Detail: errConflict.Error()})
+}
+
+func (I *JSONReport) AlreadyInLibrary(oldPath, libraryPath string) {
+	I.totals.Duplicates++
+	I.emit(Event{Event: "ALREADY_IN_LIBRARY", Old: oldPath, New: libraryPath})
+}
+
+func (I *JSONReport) Collision(filePath string, oldPaths []string, resolution string) {
+	I.totals.Collisions++
+	I.emit(Event{Event: "COLLISION", New: filePath, Sources: oldPaths, Detail: resolution})
+}
+
+func (I *JSONReport) UnlinkPreview(filePath string) {
+	I.emit(Event{Event: "UNLINK_PREVIEW", Old: filePath})
+}
+
+func (I *JSONReport) Unlinked(filePath string) {
+	I.totals.Unlinked++
+	I.emit(Event{Event: "UNLINKED", Old: filePath})
+}
+
+func (I *JSONReport) Trashing(filePath string) {
+	I.emit(Event{Event: "TRASHING", Old: filePath})
+}
+
+func (I *JSONReport) Trashed(filePath string) {
+	I.totals.Trashed++
+	I.emit(Event{Event: "TRASHED", Old: filePath})
+}
+
+func (I *JSONReport) Quarantined(oldPath, filePath string) {
+	I.totals.Quarantined++
+	I.emit(Event{Event: "QUARANTINED", Old: oldPath, New: filePath})
+}
+
+func (I *JSONReport) Deleted(filePath string) {
+	I.totals.Deleted++
+	I.emit(Event{Event: "DELETED", Old: filePath})
+}
+
+func (I *JSONReport) PurgePreview(batchPath string, age time.Duration) {
+	I.emit(Event{Event: "PURGE_PREVIEW", Old: batchPath, Detail: age.String()})
+}
+
+func (I *JSONReport) Purged(batchPath string, age time.Duration) {
+	I.totals.Purged++
+	I.emit(Event{Event: "PURGED", Old: batchPath, Detail: age.String()})
+}
+
+func (I *JSONReport) Error(oldPath, filePath string, err error) {
+	I.totals.Errors++
+	I.emit(Event{Event: "ERROR", Old: oldPath, New: filePath, Error: err.Error(), Kind: errorKind(err)})
+}
+
+func (I *JSONReport) Print() {
+	totals := I.totals
+	if I.streaming {
+		I.encode(Event{Event: "TOTALS", Totals: &totals})
+		return
+	}
+	I.encode(struct {
+		Events []Event `json:"events"`
+		Totals Totals  `json:"totals"`
+	}{I.events, totals})
+}
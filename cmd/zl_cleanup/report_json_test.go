@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONReportStreams(t *testing.T) {
+	var out bytes.Buffer
+	report := NewNDJSONReport(&out, false)
+
+	report.Source("/in/a (z-lib.org).pdf")
+	assert.Equal(t, `{"event":"SOURCE","old":"/in/a (z-lib.org).pdf"}`+"\n", out.String(), "events should be written as they happen")
+
+	report.Linked("/in/a (z-lib.org).pdf", "/out/a.pdf")
+	report.Error("/in/b (z-lib.org).pdf", "/out/b.pdf", &os.LinkError{Op: "link", Old: "b", New: "b", Err: os.ErrExist})
+	report.Print()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 4)
+	var errEvent Event
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &errEvent))
+	assert.Equal(t, "exists", errEvent.Kind)
+	assert.JSONEq(t, `{"event":"TOTALS","totals":{"sources":1,"linked":1,"homonyms":0,"skipped":0,"collisions":0,"duplicates":0,"unlinked":0,"trashed":0,"quarantined":0,"deleted":0,"purged":0,"errors":1}}`, lines[3])
+}
+
+func TestJSONReportIsASingleDocument(t *testing.T) {
+	var out bytes.Buffer
+	report := NewJSONReport(&out, false)
+
+	report.LinkPreview("/in/a (z-lib.org).pdf", "/out/a.pdf")
+	assert.Zero(t, out.Len(), "events should be buffered until printed")
+	report.Print()
+
+	var document struct {
+		Events []Event
+		Totals Totals
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &document))
+	assert.Equal(t, []Event{{Event: "LINK_PREVIEW", Old: "/in/a (z-lib.org).pdf", New: "/out/a.pdf"}}, document.Events)
+}
+
+func TestFormatError(t *testing.T) {
+	for _, format := range []string{textFormat, jsonFormat, ndjsonFormat} {
+		assert.NoError(t, formatError(format))
+	}
+	assert.EqualError(t, formatError("yaml"), `unknown format "yaml"`)
+}
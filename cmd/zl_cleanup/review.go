@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+// reviewer lets the user approve, or rename, each file before it's cleaned.
+type reviewer interface {
+	// review returns the name to use and whether the source should be cleaned at all
+	review(oldPath, cleanName string, plan planFunc) (string, bool)
+}
+
+// planFunc returns the name a source would actually get for cleanName, and the paths it would be placed at.
+type planFunc func(cleanName string) (string, []string)
+
+// promptReviewer asks, for each proposal, what to do.
+type promptReviewer struct {
+	in  *bufio.Reader
+	out io.Writer
+	// decided is set once the user accepted, or skipped, all remaining proposals
+	decided  bool
+	accepted bool
+}
+
+func newPromptReviewer(in io.Reader, out io.Writer) *promptReviewer {
+	return &promptReviewer{in: bufio.NewReader(in), out: out}
+}
+
+// stdinIsTerminal tells if the user can answer the prompts of the interactive mode.
+func stdinIsTerminal() bool {
+	fd := os.Stdin.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
+// review shows where the source would be placed, planning again any name given with edit, until a decision is made.
+func (I *promptReviewer) review(oldPath, cleanName string, plan planFunc) (string, bool) {
+	if I.decided {
+		return cleanName, I.accepted
+	}
+	cleanName, newPaths := plan(cleanName)
+	fmt.Fprintf(I.out, "%s %s\n\t%s\n", color.GreenString("SOURCE:"), filepath.Dir(oldPath), color.HiGreenString(filepath.Base(oldPath)))
+	for _, newPath := range newPaths {
+		fmt.Fprintf(I.out, "%s %s\n\t%s\n", color.WhiteString("LINK??:"), filepath.Dir(newPath), color.HiWhiteString(filepath.Base(newPath)))
+	}
+	for {
+		answer, err := I.ask("[a]ccept, [s]kip, [e]dit, accept [A]ll remaining, [q]uit skipping all remaining? ")
+		if err != nil {
+			// no more answers: skip everything left
+			I.decided, I.accepted = true, false
+			return cleanName, false
+		}
+		switch answer {
+		case "a", "y":
+			return cleanName, true
+		case "s", "n":
+			return cleanName, false
+		case "A":
+			I.decided, I.accepted = true, true
+			return cleanName, true
+		case "q":
+			I.decided, I.accepted = true, false
+			return cleanName, false
+		case "e":
+			if edited, ok := I.edit(cleanName); ok {
+				// the edited name may be taken, or adjusted, as well: it's shown before being accepted
+				return I.review(oldPath, edited, plan)
+			}
+		}
+	}
+}
+
+func (I *promptReviewer) ask(prompt string) (string, error) {
+	fmt.Fprint(I.out, prompt)
+	line, err := I.in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(I.out)
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// edit reads a new name, keeping cleanName if the answer is blank; it's not ok if the new name isn't valid.
+func (I *promptReviewer) edit(cleanName string) (string, bool) {
+	fmt.Fprintf(I.out, "current: %s\n", cleanName)
+	edited, err := I.ask("new name (blank to keep the current one): ")
+	switch {
+	case err != nil:
+		return cleanName, false
+	case edited == "":
+		return cleanName, true
+	case strings.ContainsRune(edited, filepath.Separator) || edited == "." || edited == "..":
+		fmt.Fprintln(I.out, color.RedString("a name can't be a path"))
+		return cleanName, false
+	case invalidSubstrings(edited) != nil:
+		fmt.Fprintln(I.out, color.RedString("the name contains offensive runes"))
+		return cleanName, false
+	default:
+		return edited, true
+	}
+}
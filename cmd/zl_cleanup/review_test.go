@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type proposal struct {
+	name     string
+	approved bool
+}
+
+func reviewAll(input string, cleanNames ...string) (decisions []proposal) {
+	reviewer := newPromptReviewer(strings.NewReader(input), io.Discard)
+	for _, cleanName := range cleanNames {
+		name, approved := reviewer.review("/in/"+cleanName+" (z-lib.org).pdf", cleanName, func(cleanName string) (string, []string) {
+			return cleanName, []string{"/out/" + cleanName}
+		})
+		decisions = append(decisions, proposal{name, approved})
+	}
+	return
+}
+
+func TestPromptReviewer(t *testing.T) {
+	assert.Equal(t,
+		[]proposal{{"a", true}, {"b", false}, {"c", true}, {"d", true}},
+		reviewAll("a\ns\nA\n", "a", "b", "c", "d"))
+
+	assert.Equal(t,
+		[]proposal{{"renamed", true}, {"b", false}, {"c", false}},
+		reviewAll("e\nrenamed\na\nq\n", "a", "b", "c"),
+		"an edited name is shown again before being accepted")
+
+	assert.Equal(t,
+		[]proposal{{"a", true}},
+		reviewAll("e\n\na\n", "a"),
+		"a blank edit keeps the proposed name")
+
+	assert.Equal(t,
+		[]proposal{{"fixed", true}},
+		reviewAll("e\nsub/dir\nwhat?\ne\nfixed\na\n", "a"),
+		"invalid names and answers are asked again")
+
+	assert.Equal(t,
+		[]proposal{{"a", true}, {"b", false}, {"c", false}},
+		reviewAll("a\n", "a", "b", "c"),
+		"once the input is over the remaining proposals are skipped")
+}
+
+func TestInteractiveReviewShowsFinalNames(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"Flow (z-lib.org).pdf":      "flow",
+		"Go: Intro (z-lib.org).pdf": "go",
+	})
+	writeFiles(t, destination, map[string]string{"Go- Intro.pdf": "another go"})
+	var prompts bytes.Buffer
+	deps := osDependencies()
+	deps.stdin = strings.NewReader("e\nGo: Intro.pdf\na\na\n")
+	deps.stdout, deps.stderr = io.Discard, &prompts
+	config := Config{
+		sourceDirectory:        source,
+		destinationDirectories: []string{destination},
+		rules:                  DefaultRuleSet(),
+		doRun:                  true,
+		interactive:            true,
+		format:                 ndjsonFormat,
+		onConflict:             suffixOnConflict,
+		onCollision:            disambiguateCollisions,
+		linkMode:               hardlinkMode,
+		fsReserved:             replaceReserved,
+		fsProfiles:             map[string]string{destination: "smb"},
+		jobs:                   1,
+		journalPath:            filepath.Join(t.TempDir(), "journal.jsonl"),
+	}
+
+	assert.Equal(t, exitSuccess, linkToCleanPath(config, deps))
+
+	// Flow is renamed as the other source is planned, so it's suffixed; that other source then finds both names taken
+	shown := prompts.String()
+	assert.Contains(t, shown, "\tGo- Intro (2).pdf\n", "the edited name is shown adjusted and made free within the batch")
+	assert.Contains(t, shown, "\tGo- Intro (3).pdf\n", "the name is shown as suffixed by the conflict policy")
+	assert.NotContains(t, shown, "\tGo: Intro.pdf\n", "names are shown adjusted to the destination")
+	content := func(name string) string {
+		b, _ := os.ReadFile(filepath.Join(destination, name))
+		return string(b)
+	}
+	assert.Equal(t, "another go", content("Go- Intro.pdf"))
+	assert.Equal(t, "flow", content("Go- Intro (2).pdf"))
+	assert.Equal(t, "go", content("Go- Intro (3).pdf"))
+}
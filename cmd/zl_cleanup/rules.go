@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+/*
+A rules file is a TOML document declaring, in evaluation order, the detectors
+telling which files are dirty and the rewrites turning a dirty name into a clean one.
+
+	[[dirty]]
+	name = "z-library"
+	contains = "z-lib"       # case-insensitive substring
+
+	[[dirty]]
+	name = "annas-archive"
+	pattern = '(?i)anna.?s.archive'
+
+	[[rule]]
+	name = "z-lib suffix"
+	kind = "literal"
+	match = " (z-lib.org)"
+	replace = ""
+
+	[[rule]]
+	name = "collapse spaces"
+	kind = "regexp"
+	match = '(\s)\s+'
+	replace = '$1'
+*/
+
+const (
+	literalRule = "literal"
+	regexpRule  = "regexp"
+)
+
+type Detector struct {
+	Name     string `toml:"name"`
+	Contains string `toml:"contains"`
+	Pattern  string `toml:"pattern"`
+	re       *regexp.Regexp
+}
+
+func (I Detector) matches(fileName string) bool {
+	if I.re != nil {
+		return I.re.MatchString(fileName)
+	}
+	return strings.Contains(strings.ToLower(fileName), strings.ToLower(I.Contains))
+}
+
+type Rule struct {
+	Name    string `toml:"name"`
+	Kind    string `toml:"kind"`
+	Match   string `toml:"match"`
+	Replace string `toml:"replace"`
+	re      *regexp.Regexp
+}
+
+// apply returns the rewritten name and the substrings of fileName the rule matched.
+func (I Rule) apply(fileName string) (string, []string) {
+	if I.re != nil {
+		return I.re.ReplaceAllString(fileName, I.Replace), I.re.FindAllString(fileName, -1)
+	}
+	n := strings.Count(fileName, I.Match)
+	if n == 0 {
+		return fileName, nil
+	}
+	matches := make([]string, n)
+	for i := range matches {
+		matches[i] = I.Match
+	}
+	return strings.ReplaceAll(fileName, I.Match, I.Replace), matches
+}
+
+type RuleSet struct {
+	Dirty     []Detector     `toml:"dirty"`
+	Normalize *Normalization `toml:"normalize"`
+	Rules     []Rule         `toml:"rule"`
+}
+
+// Change records how a single rule rewrote a filename.
+type Change struct {
+	Rule    string   `json:"rule"`
+	Matches []string `json:"matches"`
+	Before  string   `json:"before"`
+	After   string   `json:"after"`
+}
+
+func (I RuleSet) IsDirty(fileName string) bool {
+	for _, d := range I.Dirty {
+		if d.matches(fileName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clean normalizes the name and applies every rule, in order, returning the final name along with the changes made by each step that matched.
+func (I RuleSet) Clean(fileName string) (string, []Change) {
+	var changes []Change
+	if I.Normalize != nil {
+		fileName, changes = I.Normalize.Apply(fileName)
+	}
+	for _, rule := range I.Rules {
+		after, matches := rule.apply(fileName)
+		if after != fileName {
+			changes = append(changes, Change{
+				Rule:    rule.Name,
+				Matches: matches,
+				Before:  fileName,
+				After:   after,
+			})
+		}
+		fileName = after
+	}
+	return fileName, changes
+}
+
+func (I *RuleSet) compile() (errs []error) {
+	if len(I.Dirty) == 0 {
+		errs = append(errs, errors.New("at least one 'dirty' detector is required"))
+	}
+	for i := range I.Dirty {
+		d := &I.Dirty[i]
+		if d.Name == "" {
+			d.Name = fmt.Sprintf("dirty#%d", i+1)
+		}
+		switch {
+		case d.Pattern != "" && d.Contains != "":
+			errs = append(errs, fmt.Errorf("detector %q: either 'contains' or 'pattern' should be given", d.Name))
+		case d.Pattern != "":
+			re, err := regexp.Compile(d.Pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("detector %q: %w", d.Name, err))
+			}
+			d.re = re
+		case d.Contains == "":
+			errs = append(errs, fmt.Errorf("detector %q: 'contains' or 'pattern' is required", d.Name))
+		}
+	}
+	if I.Normalize != nil {
+		errs = append(errs, I.Normalize.compile()...)
+	}
+	for i := range I.Rules {
+		r := &I.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule#%d", i+1)
+		}
+		if r.Match == "" {
+			errs = append(errs, fmt.Errorf("rule %q: 'match' is required", r.Name))
+			continue
+		}
+		switch r.Kind {
+		case literalRule, "":
+			r.Kind = literalRule
+		case regexpRule:
+			re, err := regexp.Compile(r.Match)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rule %q: %w", r.Name, err))
+			}
+			r.re = re
+		default:
+			errs = append(errs, fmt.Errorf("rule %q: unknown kind %q, expected %q or %q", r.Name, r.Kind, literalRule, regexpRule))
+		}
+	}
+	return
+}
+
+// normalizeWith replaces the [normalize] table with the `-normalize` flag value, keeping the transliterations it declares.
+func (I *RuleSet) normalizeWith(value string) error {
+	normalization, err := parseNormalization(value)
+	if err != nil {
+		return err
+	}
+	if normalization != nil && I.Normalize != nil {
+		normalization.Transliterations = I.Normalize.Transliterations
+	}
+	I.Normalize = normalization
+	return nil
+}
+
+// LoadRuleSet reads and compiles the rules file at filePath.
+func LoadRuleSet(filePath string) (rules RuleSet, errs []error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return rules, []error{err}
+	}
+	defer f.Close()
+	decoder := toml.NewDecoder(f).DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return rules, []error{fmt.Errorf("parsing rules file %q: %w", filePath, err)}
+	}
+	return rules, rules.compile()
+}
+
+// DefaultRuleSet is used when no rules file is given; it cleans up files downloaded from z-library.
+func DefaultRuleSet() RuleSet {
+	const space = " "
+	literal := func(name, match, replace string) Rule {
+		return Rule{Name: name, Kind: literalRule, Match: match, Replace: replace}
+	}
+	rules := RuleSet{
+		Dirty: []Detector{
+			{Name: "z-library", Contains: "z-lib"},
+		},
+		Rules: []Rule{
+			literal("no-break space", "\u00a0", space),
+			literal("no-break space (latin-1)", "\xa0", space),
+			literal("tab", "\t", space),
+			literal("z-lib.org suffix", " (z-lib.org)", ""),
+			literal("Z-Library suffix", " (Z-Library)", ""),
+			literal("double dot", "..", ""),
+			literal("em dash", "—", "-"),
+			literal("two-em dash", "⸺", "-"),
+			literal("three-em dash", "⸻", "-"),
+			literal("small em dash", "﹘", "-"),
+			literal("en dash", "–", "-"),
+			literal("figure dash", "‒", "-"),
+			// for reference: `(?i)\s*\(\s*(?:https?...)?z-lib\.org\s*\)\s*`
+			{Name: "collapse spaces", Kind: regexpRule, Match: `(\s)\s+`, Replace: `$1`},
+			{Name: "collapse dots", Kind: regexpRule, Match: `(\.)\.+`, Replace: `$1`},
+		},
+	}
+	if errs := rules.compile(); len(errs) > 0 {
+		panic(errors.Join(errs...))
+	}
+	return rules
+}
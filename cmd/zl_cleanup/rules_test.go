@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultRuleSet(t *testing.T) {
+	cases := []struct {
+		dirty bool
+		name  string
+		clean string
+	}{
+		{
+			dirty: true,
+			name:  "9781101152140 • Drive • by Daniel H. Pink • Riverhead Books (z-lib.org).epub",
+			clean: "9781101152140 • Drive • by Daniel H. Pink • Riverhead Books.epub",
+		},
+		{
+			dirty: true,
+			name:  "Effective Java —  Third Edition (Z-Library)...pdf",
+			clean: "Effective Java - Third Edition.pdf",
+		},
+		{
+			name:  "Grønbaek.pdf",
+			clean: "Grønbaek.pdf",
+		},
+	}
+	rules := DefaultRuleSet()
+	for n, tc := range cases {
+		t.Run(fmt.Sprintf("%0.2d:%q", n, tc.name), func(t *testing.T) {
+			assert.Equal(t, tc.dirty, rules.IsDirty(tc.name))
+			clean, _ := rules.Clean(tc.name)
+			assert.Equal(t, tc.clean, clean)
+		})
+	}
+}
+
+func TestCleanExplainsChanges(t *testing.T) {
+	_, changes := DefaultRuleSet().Clean("Go  in Action (z-lib.org).epub")
+	expected := []Change{
+		{
+			Rule:    "z-lib.org suffix",
+			Matches: []string{" (z-lib.org)"},
+			Before:  "Go  in Action (z-lib.org).epub",
+			After:   "Go  in Action.epub",
+		},
+		{
+			Rule:    "collapse spaces",
+			Matches: []string{"  "},
+			Before:  "Go  in Action.epub",
+			After:   "Go in Action.epub",
+		},
+	}
+	assert.Equal(t, expected, changes)
+}
+
+func TestLoadRuleSet(t *testing.T) {
+	rules, errs := LoadRuleSet("rules.sample.toml")
+	require.Empty(t, errs)
+	name := "Clean Code – A Handbook -- Anna’s Archive.epub"
+	assert.True(t, rules.IsDirty(name))
+	clean, _ := rules.Clean(name)
+	assert.Equal(t, "Clean Code - A Handbook.epub", clean)
+}
+
+func TestLoadRuleSetErrors(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rules.toml")
+	content := `
+[[rule]]
+name = "bad kind"
+kind = "glob"
+match = "*"
+
+[[rule]]
+name = "bad regexp"
+kind = "regexp"
+match = "(("
+`
+	require.NoError(t, os.WriteFile(rulesFile, []byte(content), 0o644))
+	_, errs := LoadRuleSet(rulesFile)
+	assert.Len(t, errs, 3)
+}
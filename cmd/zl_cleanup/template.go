@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"dev.acorello.it/go/arkivist/cmd/zl_cleanup/bookmeta"
+)
+
+// canonicalTemplate renders our canonical "ISBN • Title • by Author • Publisher" names, skipping the missing parts.
+const canonicalTemplate = `{{with .ISBN}}{{.}} • {{end}}{{.Title}}{{with .Author}} • by {{.}}{{end}}{{with .Publisher}} • {{.}}{{end}}`
+
+/*
+nameTemplate renders the name of a book from the metadata embedded in it.
+
+Besides the fields of bookmeta.Metadata (Title, Authors, Publisher, Identifiers, Date) and
+its methods (Author, ISBN, Year) the template can use CleanName, the name produced by the
+rules without extension, and Ext. The extension is appended to the rendered name.
+*/
+type nameTemplate struct {
+	*template.Template
+}
+
+type templateData struct {
+	bookmeta.Metadata
+	CleanName string
+	Ext       string
+}
+
+// parseNameTemplate parses text; "canonical" stands for canonicalTemplate.
+func parseNameTemplate(text string) (*nameTemplate, error) {
+	if text == "canonical" {
+		text = canonicalTemplate
+	}
+	t, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return &nameTemplate{t}, nil
+}
+
+// pathSeparators can't be part of a name
+var pathSeparators = strings.NewReplacer("/", "-", "\\", "-")
+
+// rename returns the name rendered from the metadata of the file at filePath, falling back to cleanName when the file has no title.
+func (I *nameTemplate) rename(filePath, cleanName string) (string, error) {
+	metadata, err := bookmeta.Read(filePath)
+	if err != nil || metadata.Title == "" {
+		return cleanName, nil
+	}
+	ext := filepath.Ext(cleanName)
+	var sb strings.Builder
+	if err := I.Execute(&sb, templateData{
+		Metadata:  metadata,
+		CleanName: strings.TrimSuffix(cleanName, ext),
+		Ext:       ext,
+	}); err != nil {
+		return cleanName, err
+	}
+	name := strings.Join(strings.Fields(pathSeparators.Replace(sb.String())), " ")
+	if name == "" {
+		return cleanName, nil
+	}
+	return name + ext, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePDF(t *testing.T, info string) string {
+	t.Helper()
+	pdf := "%PDF-1.4\n2 0 obj\n<< " + info + " >>\nendobj\ntrailer\n<< /Info 2 0 R >>\n%%EOF\n"
+	filePath := filepath.Join(t.TempDir(), "Drive (z-lib.org).pdf")
+	require.NoError(t, os.WriteFile(filePath, []byte(pdf), 0o644))
+	return filePath
+}
+
+func TestNameTemplate(t *testing.T) {
+	cases := []struct {
+		template string
+		info     string
+		expected string
+	}{
+		{
+			template: "canonical",
+			info:     "/Title (Drive) /Author (Daniel H. Pink)",
+			expected: "Drive • by Daniel H. Pink.pdf",
+		},
+		{
+			template: "{{.Title}} ({{.CleanName}})",
+			info:     "/Title (Either/Or)",
+			expected: "Either-Or (Drive).pdf",
+		},
+		{
+			// no title, no rename
+			template: "canonical",
+			info:     "/Author (Daniel H. Pink)",
+			expected: "Drive.pdf",
+		},
+	}
+	for _, c := range cases {
+		tmpl, err := parseNameTemplate(c.template)
+		require.NoError(t, err)
+		name, err := tmpl.rename(writePDF(t, c.info), "Drive.pdf")
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, name, c.template)
+	}
+}
+
+func TestNameTemplateNotABook(t *testing.T) {
+	tmpl, err := parseNameTemplate("{{.Title}}")
+	require.NoError(t, err)
+	name, err := tmpl.rename(filepath.Join(t.TempDir(), "notes.txt"), "notes.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "notes.txt", name)
+}
+
+func TestParseNameTemplateInvalid(t *testing.T) {
+	_, err := parseNameTemplate("{{.Title")
+	assert.Error(t, err)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package trash
+
+import "errors"
+
+func device(path string) (uint64, error) {
+	return 0, errors.New("device lookup not supported")
+}
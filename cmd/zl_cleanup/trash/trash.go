@@ -0,0 +1,50 @@
+// Package trash moves files to the desktop trash instead of deleting them.
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Trasher moves files to a trash from where the user can still restore them.
+type Trasher interface {
+	// Trash moves every file to the trash, the returned error joins the failures of the single files.
+	Trash(filePaths ...string) error
+}
+
+// New returns the Trasher native to the running OS: Finder on macOS, the freedesktop.org trash elsewhere.
+func New() (Trasher, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return Finder{}, nil
+	case "windows", "plan9", "js", "wasip1":
+		return nil, fmt.Errorf("trash not supported on %s", runtime.GOOS)
+	default:
+		return NewXDG()
+	}
+}
+
+// Finder asks the macOS Finder to delete the files, as if the user did it.
+type Finder struct{}
+
+func (Finder) Trash(filePaths ...string) error {
+	if len(filePaths) == 0 {
+		return nil
+	}
+	var fileNames strings.Builder
+	for _, fileName := range filePaths {
+		if fileNames.Len() > 0 {
+			fileNames.WriteString(", ")
+		}
+		fileNames.WriteString(fmt.Sprintf(`POSIX file "%s"`, fileName))
+	}
+	osascript := fmt.Sprintf(`tell application "Finder" to delete {%s}`, fileNames.String())
+	out, err := exec.Command("osascript", "-e", osascript).CombinedOutput()
+	if err != nil {
+		return errors.Join(err, errors.New(strings.TrimSpace(string(out))))
+	}
+	return nil
+}
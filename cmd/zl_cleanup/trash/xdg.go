@@ -0,0 +1,186 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+XDG implements the freedesktop.org Trash specification
+(https://specifications.freedesktop.org/trash-spec/trashspec-latest.html).
+
+Files living on the same device as the home trash ($XDG_DATA_HOME/Trash) are moved there;
+files on other mounts go to $topdir/.Trash/$uid, when the administrator provided a sticky
+$topdir/.Trash, or to $topdir/.Trash-$uid otherwise.
+
+Each trash has a `files` directory holding the trashed files and an `info` directory holding,
+for each of them, a `<name>.trashinfo` file recording the original path and the deletion date.
+*/
+type XDG struct {
+	// HomeTrash is usually $XDG_DATA_HOME/Trash
+	HomeTrash string
+	uid       int
+	now       func() time.Time
+	device    func(path string) (uint64, error)
+}
+
+// NewXDG returns a trasher using $XDG_DATA_HOME/Trash, or ~/.local/share/Trash if the variable is not set, as home trash.
+func NewXDG() (*XDG, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("locating the home trash: %w", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return &XDG{
+		HomeTrash: filepath.Join(dataHome, "Trash"),
+		uid:       os.Getuid(),
+		now:       time.Now,
+		device:    device,
+	}, nil
+}
+
+func (I *XDG) Trash(filePaths ...string) error {
+	var errs []error
+	for _, filePath := range filePaths {
+		if err := I.trash(filePath); err != nil {
+			errs = append(errs, fmt.Errorf("trashing %q: %w", filePath, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (I *XDG) trash(filePath string) error {
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	trashDir, infoPath, err := I.trashFor(filePath)
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(trashDir, dir), 0o700); err != nil {
+			return err
+		}
+	}
+	trashName, info, err := I.reserveName(trashDir, filepath.Base(filePath))
+	if err != nil {
+		return err
+	}
+	if err := writeTrashInfo(info, infoPath, I.now()); err != nil {
+		os.Remove(info.Name())
+		return err
+	}
+	if err := os.Rename(filePath, filepath.Join(trashDir, "files", trashName)); err != nil {
+		os.Remove(info.Name())
+		return err
+	}
+	return nil
+}
+
+// trashFor picks the trash directory for filePath and the path to record in its trash info.
+func (I *XDG) trashFor(filePath string) (trashDir, infoPath string, err error) {
+	fileDevice, err := I.device(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(I.HomeTrash, 0o700); err != nil {
+		return "", "", err
+	}
+	homeDevice, err := I.device(I.HomeTrash)
+	if err != nil {
+		return "", "", err
+	}
+	if fileDevice == homeDevice {
+		return I.HomeTrash, filePath, nil
+	}
+	topDir, err := I.topDir(filePath, fileDevice)
+	if err != nil {
+		return "", "", err
+	}
+	infoPath, err = filepath.Rel(topDir, filePath)
+	if err != nil {
+		return "", "", err
+	}
+	uid := strconv.Itoa(I.uid)
+	adminTrash := filepath.Join(topDir, ".Trash")
+	if isStickyDir(adminTrash) {
+		return filepath.Join(adminTrash, uid), infoPath, nil
+	}
+	return filepath.Join(topDir, ".Trash-"+uid), infoPath, nil
+}
+
+// topDir returns the mount point containing filePath: the last ancestor on the same device.
+func (I *XDG) topDir(filePath string, fileDevice uint64) (string, error) {
+	dir := filepath.Dir(filePath)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		parentDevice, err := I.device(parent)
+		if err != nil {
+			return "", err
+		}
+		if parentDevice != fileDevice {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
+
+// isStickyDir tells if path is a real directory, not a symlink, with the sticky bit set, as required for an administrator-provided trash.
+func isStickyDir(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	return info.IsDir() && info.Mode()&fs.ModeSticky != 0
+}
+
+// reserveName atomically creates the trash info file of a name not yet used in the trash.
+func (I *XDG) reserveName(trashDir, fileName string) (string, *os.File, error) {
+	ext := filepath.Ext(fileName)
+	stem := strings.TrimSuffix(fileName, ext)
+	for n := 1; ; n++ {
+		candidate := fileName
+		if n > 1 {
+			candidate = fmt.Sprintf("%s.%d%s", stem, n, ext)
+		}
+		infoFile := filepath.Join(trashDir, "info", candidate+".trashinfo")
+		f, err := os.OpenFile(infoFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		switch {
+		case err == nil:
+			if _, err := os.Lstat(filepath.Join(trashDir, "files", candidate)); err == nil {
+				// a trashed file without its info, leave both alone
+				f.Close()
+				os.Remove(infoFile)
+				continue
+			}
+			return candidate, f, nil
+		case errors.Is(err, fs.ErrExist):
+			continue
+		default:
+			return "", nil, err
+		}
+	}
+}
+
+func writeTrashInfo(f *os.File, path string, deletionDate time.Time) error {
+	escapedPath := (&url.URL{Path: filepath.ToSlash(path)}).EscapedPath()
+	_, err := fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escapedPath, deletionDate.Format("2006-01-02T15:04:05"))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var deletionDate = time.Date(2023, 5, 14, 22, 32, 8, 0, time.Local)
+
+func newTestXDG(t *testing.T) (*XDG, string) {
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	trasher, err := NewXDG()
+	require.NoError(t, err)
+	trasher.now = func() time.Time { return deletionDate }
+	return trasher, dataHome
+}
+
+func touch(t *testing.T, path string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(path), 0o644))
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestHomeTrash(t *testing.T) {
+	trasher, dataHome := newTestXDG(t)
+	assert.Equal(t, filepath.Join(dataHome, "Trash"), trasher.HomeTrash)
+
+	downloads := filepath.Join(dataHome, "Downloads")
+	first := filepath.Join(downloads, "Go in Action.epub")
+	second := filepath.Join(downloads, "older", "Go in Action.epub")
+	touch(t, first)
+	touch(t, second)
+
+	require.NoError(t, trasher.Trash(first, second))
+
+	assert.NoFileExists(t, first)
+	assert.NoFileExists(t, second)
+	assert.Equal(t, first, readFile(t, filepath.Join(trasher.HomeTrash, "files", "Go in Action.epub")))
+	assert.Equal(t, second, readFile(t, filepath.Join(trasher.HomeTrash, "files", "Go in Action.2.epub")))
+	expectedInfo := "[Trash Info]\n" +
+		"Path=" + strings.ReplaceAll(filepath.ToSlash(second), " ", "%20") + "\n" +
+		"DeletionDate=2023-05-14T22:32:08\n"
+	assert.Equal(t, expectedInfo, readFile(t, filepath.Join(trasher.HomeTrash, "info", "Go in Action.2.epub.trashinfo")))
+}
+
+func TestTopDirTrash(t *testing.T) {
+	trasher, dataHome := newTestXDG(t)
+	mount := filepath.Join(dataHome, "mnt", "nas")
+	trasher.device = func(path string) (uint64, error) {
+		if strings.HasPrefix(path, mount) {
+			return 2, nil
+		}
+		return 1, nil
+	}
+	book := filepath.Join(mount, "books", "SICP.pdf")
+	touch(t, book)
+
+	require.NoError(t, trasher.Trash(book))
+
+	trashDir := filepath.Join(mount, ".Trash-"+strconv.Itoa(os.Getuid()))
+	assert.FileExists(t, filepath.Join(trashDir, "files", "SICP.pdf"))
+	assert.Contains(t, readFile(t, filepath.Join(trashDir, "info", "SICP.pdf.trashinfo")), "\nPath=books/SICP.pdf\n")
+
+	adminTrash := filepath.Join(mount, ".Trash")
+	require.NoError(t, os.Mkdir(adminTrash, 0o777))
+	require.NoError(t, os.Chmod(adminTrash, 0o777|os.ModeSticky))
+	touch(t, book)
+
+	require.NoError(t, trasher.Trash(book))
+
+	assert.FileExists(t, filepath.Join(adminTrash, strconv.Itoa(os.Getuid()), "files", "SICP.pdf"))
+}
+
+func TestTrashReportsEveryFailure(t *testing.T) {
+	trasher, dataHome := newTestXDG(t)
+	existing := filepath.Join(dataHome, "a.pdf")
+	touch(t, existing)
+
+	err := trasher.Trash(filepath.Join(dataHome, "missing-1.pdf"), existing, filepath.Join(dataHome, "missing-2.pdf"))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing-1.pdf")
+	assert.Contains(t, err.Error(), "missing-2.pdf")
+	assert.NoFileExists(t, existing)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// journaledSource collects what a run did to a single source file.
+type journaledSource struct {
+	path  string
+	links []JournalEntry
+	// kept are the files that already held the content of the source: restored from, but never removed
+	kept    []JournalEntry
+	removal *JournalEntry
+}
+
+func groupBySource(entries []JournalEntry) (sources []*journaledSource) {
+	bySource := map[string]*journaledSource{}
+	for i, entry := range entries {
+		source, found := bySource[entry.Source]
+		if !found {
+			source = &journaledSource{path: entry.Source}
+			bySource[entry.Source] = source
+			sources = append(sources, source)
+		}
+		switch entry.Op {
+		case linkOp:
+			source.links = append(source.links, entry)
+		case keptOp:
+			source.kept = append(source.kept, entry)
+		default:
+			source.removal = &entries[i]
+		}
+	}
+	return
+}
+
+// sameFile tells if path is still the file recorded in the journal.
+func (I dependencies) sameFile(path string, id fileID) bool {
+	current, err := I.statFileID(path)
+	return err == nil && current == id
+}
+
+func (I dependencies) identical(aPath, bPath string) bool {
+	same, err := I.sameContent(aPath, bPath)
+	return err == nil && same
+}
+
+/*
+undoSource restores a removed source from one of its links, or of the files that already held its content,
+then removes the links, but only when each link is still the journaled file and the source holds its same bytes.
+*/
+func undoSource(source *journaledSource, dryRun bool, report Reporter, deps dependencies) {
+	if source.removal != nil {
+		restored := false
+		switch {
+		case deps.fileExists(source.path):
+			report.Error(source.path, source.path, errors.New("cannot restore, a file already exists at the source path"))
+		default:
+			for _, link := range append(append([]JournalEntry(nil), source.links...), source.kept...) {
+				if !deps.sameFile(link.Destination, link.fileID) {
+					continue
+				}
+				if dryRun {
+					report.LinkPreview(link.Destination, source.path)
+					restored = true
+				} else if err := deps.autoLinker(Config{}.fsProfileFor)(link.Destination, source.path); err != nil {
+					report.Error(link.Destination, source.path, err)
+				} else {
+					report.Linked(link.Destination, source.path)
+					restored = true
+				}
+				break
+			}
+			if !restored {
+				report.Error(source.path, source.path, errors.New("cannot restore, no destination is still the journaled file"))
+			}
+		}
+		if !restored {
+			return
+		}
+	}
+	for _, link := range source.links {
+		switch {
+		case !deps.sameFile(link.Destination, link.fileID):
+			report.Error(source.path, link.Destination, fmt.Errorf("cannot unlink, destination is missing or isn't inode %d anymore", link.Inode))
+		case !dryRun && !deps.identical(source.path, link.Destination):
+			report.Error(source.path, link.Destination, errors.New("cannot unlink, the source doesn't hold the same bytes anymore"))
+		case dryRun:
+			report.UnlinkPreview(link.Destination)
+		default:
+			if err := deps.remove(link.Destination); err != nil {
+				report.Error(source.path, link.Destination, err)
+			} else {
+				report.Unlinked(link.Destination)
+			}
+		}
+	}
+}
+
+// undo implements the `undo` sub-command: `zl_cleanup undo [-run] JOURNAL`.
+func undo(args []string) {
+	flags := flag.NewFlagSet("undo", flag.ExitOnError)
+	doRun := flags.Bool("run", false, "execute the operation")
+	format := flags.String("format", textFormat, "report format: text, json or ndjson (streamed)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: zl_cleanup undo [-run] [-format FORMAT] JOURNAL")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(exitConfigError)
+	}
+	if err := formatError(*format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flags.Usage()
+		os.Exit(exitConfigError)
+	}
+	deps := osDependencies()
+	entries, err := ReadJournal(flags.Arg(0), deps)
+	if err != nil {
+		fmt.Fprintf(deps.stderr, "Error reading journal:\n%v\n", err)
+		os.Exit(exitConfigError)
+	}
+	report := NewReporter(Config{doRun: *doRun, format: *format}, deps.stdout, deps.stderr)
+	sources := groupBySource(entries)
+	for i := len(sources) - 1; i >= 0; i-- {
+		undoSource(sources[i], !*doRun, report, deps)
+	}
+	report.Print()
+	os.Exit(exitCode(report.Totals(), false))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// browsers download into a temporary file, renaming it once complete
+var browserTempSuffixes = []string{".part", ".partial", ".crdownload", ".download", ".opdownload", ".tmp"}
+
+func isBrowserTemp(fileName string) bool {
+	fileName = strings.ToLower(fileName)
+	for _, suffix := range browserTempSuffixes {
+		if strings.HasSuffix(fileName, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// settler tells when files stop growing: a file is settled once its size hasn't changed for a while.
+type settler struct {
+	quiet   time.Duration
+	pending map[string]*growth
+}
+
+type growth struct {
+	size  int64
+	since time.Time
+}
+
+func newSettler(quiet time.Duration) *settler {
+	return &settler{quiet: quiet, pending: map[string]*growth{}}
+}
+
+// touch records the file at path has just changed.
+func (I *settler) touch(path string, now time.Time) {
+	I.pending[path] = &growth{size: -1, since: now}
+}
+
+// settled returns, and forgets, the files whose size didn't change in the last quiet period; files gone missing are forgotten too.
+func (I *settler) settled(now time.Time, sizeOf func(path string) (int64, error)) (paths []string) {
+	for path, g := range I.pending {
+		size, err := sizeOf(path)
+		switch {
+		case err != nil:
+			delete(I.pending, path)
+		case size != g.size:
+			g.size = size
+			g.since = now
+		case now.Sub(g.since) >= I.quiet:
+			delete(I.pending, path)
+			paths = append(paths, path)
+		}
+	}
+	return
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// watch cleans the dirty files already in the source directory, then keeps cleaning the new ones as they land there, until interrupted; it returns the exit code.
+func watch(config Config, deps dependencies) int {
+	job, err := newJob(config, deps)
+	if err != nil {
+		fmt.Fprintf(deps.stderr, "Error starting:\n%v\n", err)
+		return exitConfigError
+	}
+	defer job.close()
+	events, stop, err := watchDirectory(config)
+	if err != nil {
+		fmt.Fprintf(deps.stderr, "Error watching the source directory:\n%v\n", err)
+		return exitConfigError
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	files, err := dirtyFiles(config, deps)
+	if err != nil {
+		fmt.Fprintf(deps.stderr, "Error listing sources:\n%v\n", err)
+		return exitConfigError
+	}
+	job.removeSources(job.clean(files))
+
+	settler := newSettler(config.settle)
+	ticker := time.NewTicker(config.settle / 4)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case path, open := <-events:
+			if !open {
+				break loop
+			}
+			if !isBrowserTemp(path) {
+				settler.touch(path, time.Now())
+			}
+		case now := <-ticker.C:
+			for _, path := range settler.settled(now, fileSize) {
+				if f, wanted := config.sourceFileAt(path); wanted {
+					job.removeSources(job.clean([]sourceFile{f}))
+				}
+			}
+			if job.aborted {
+				break loop
+			}
+		case <-signals:
+			break loop
+		}
+	}
+	stop()
+	job.report.Print()
+	return exitCode(job.report.Totals(), job.aborted)
+}
+
+// sourceFileAt returns the file at path, and whether it should be cleaned.
+func (I Config) sourceFileAt(path string) (sourceFile, bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return sourceFile{}, false
+	}
+	relPath, err := filepath.Rel(I.sourceDirectory, path)
+	if err != nil {
+		return sourceFile{}, false
+	}
+	f := sourceFile{relPath, fs.FileInfoToDirEntry(info)}
+	return f, I.wants(relPath, f)
+}
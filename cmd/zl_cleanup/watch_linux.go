@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchedEvents = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO
+
+// watchDirectory sends the path of every file created or written in the source directory, and in its sub-directories when recursive;
+// the channel is closed after stop is called.
+func watchDirectory(config Config) (events <-chan string, stop func(), err error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("inotify_init1", err)
+	}
+	// non blocking, so that the runtime poller can interrupt reads on Close
+	inotify := os.NewFile(uintptr(fd), "inotify")
+	dirs := map[int]string{}
+	addWatch := func(dir string) error {
+		wd, err := unix.InotifyAddWatch(fd, dir, watchedEvents)
+		if err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		dirs[wd] = dir
+		return nil
+	}
+	root := config.sourceDirectory
+	// watchTree watches dir and the directories below it, telling each file found to found
+	watchTree := func(dir string, found func(path string) bool) error {
+		return filepath.WalkDir(dir, func(path string, f fs.DirEntry, stumbled error) error {
+			if stumbled != nil {
+				return stumbled
+			}
+			if !f.IsDir() {
+				if !found(path) {
+					return fs.SkipAll
+				}
+				return nil
+			}
+			if path != root {
+				relPath, _ := filepath.Rel(root, path)
+				if !config.recursive || matchesAny(config.exclude, relPath) {
+					return filepath.SkipDir
+				}
+			}
+			return addWatch(path)
+		})
+	}
+	if err = watchTree(root, func(string) bool { return true }); err != nil {
+		inotify.Close()
+		return nil, nil, err
+	}
+
+	paths := make(chan string)
+	done := make(chan struct{})
+	send := func(path string) bool {
+		select {
+		case paths <- path:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	go func() {
+		defer close(paths)
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for {
+			n, err := inotify.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameStart := offset + unix.SizeofInotifyEvent
+				name := strings.TrimRight(string(buf[nameStart:nameStart+int(event.Len)]), "\x00")
+				offset = nameStart + int(event.Len)
+				dir, known := dirs[int(event.Wd)]
+				if !known || name == "" {
+					continue
+				}
+				path := filepath.Join(dir, name)
+				if event.Mask&unix.IN_ISDIR != 0 {
+					// files may land in a new directory before it's watched: those already there are sent as found
+					if config.recursive && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+						sent := true
+						watchTree(path, func(filePath string) bool {
+							sent = send(filePath)
+							return sent
+						})
+						if !sent {
+							return
+						}
+					}
+					continue
+				}
+				if !send(path) {
+					return
+				}
+			}
+		}
+	}()
+	stop = func() {
+		close(done)
+		inotify.Close()
+	}
+	return paths, stop, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextEvent waits for an event, failing the test once the deadline passes.
+func nextEvent(t *testing.T, events <-chan string, deadline <-chan time.Time) string {
+	t.Helper()
+	select {
+	case path := <-events:
+		return path
+	case <-deadline:
+		t.Fatal("no event received")
+		return ""
+	}
+}
+
+func TestWatchDirectory(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "ignored"), 0o755))
+	events, stop, err := watchDirectory(Config{sourceDirectory: root, recursive: true, exclude: []string{"ignored"}})
+	require.NoError(t, err)
+	defer stop()
+
+	// the file may be written before the new directory is watched: it's then found when the directory is
+	require.NoError(t, os.Mkdir(filepath.Join(root, "2023-05"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "ignored", "a.pdf"), nil, 0o644))
+	book := filepath.Join(root, "2023-05", "b (z-lib.org).pdf")
+	require.NoError(t, os.WriteFile(book, nil, 0o644))
+
+	deadline := time.After(5 * time.Second)
+	assert.Equal(t, book, nextEvent(t, events, deadline))
+
+	// events of the same file may repeat: the next different one proves the excluded directory was skipped
+	last := filepath.Join(root, "c (z-lib.org).pdf")
+	require.NoError(t, os.WriteFile(last, nil, 0o644))
+	for path := nextEvent(t, events, deadline); path != last; path = nextEvent(t, events, deadline) {
+		assert.Equal(t, book, path)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func watchDirectory(config Config) (events <-chan string, stop func(), err error) {
+	return nil, nil, errors.New("watch mode is supported only on Linux")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettler(t *testing.T) {
+	sizes := map[string]int64{"growing.pdf": 10, "done.pdf": 100}
+	sizeOf := func(path string) (int64, error) {
+		size, found := sizes[path]
+		if !found {
+			return 0, os.ErrNotExist
+		}
+		return size, nil
+	}
+	start := time.Now()
+	settler := newSettler(2 * time.Second)
+	for _, path := range []string{"growing.pdf", "done.pdf", "vanished.pdf"} {
+		settler.touch(path, start)
+	}
+
+	assert.Empty(t, settler.settled(start.Add(time.Second), sizeOf))
+	sizes["growing.pdf"] = 20
+	assert.Empty(t, settler.settled(start.Add(2*time.Second), sizeOf))
+	assert.Equal(t, []string{"done.pdf"}, settler.settled(start.Add(3*time.Second), sizeOf))
+	assert.Equal(t, []string{"growing.pdf"}, settler.settled(start.Add(4*time.Second), sizeOf))
+	assert.Empty(t, settler.pending)
+}
+
+func TestIsBrowserTemp(t *testing.T) {
+	assert.True(t, isBrowserTemp("Drive (z-lib.org).epub.crdownload"))
+	assert.True(t, isBrowserTemp("Drive (z-lib.org).epub.PART"))
+	assert.False(t, isBrowserTemp("Drive (z-lib.org).epub"))
+}
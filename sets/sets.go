@@ -37,3 +37,14 @@ func (I Set[E]) Intersection(o Set[E]) Set[E] {
 	}
 	return commonFiles
 }
+
+func (I Set[E]) Union(o Set[E]) Set[E] {
+	union := New[E]()
+	for f := range I {
+		union.Add(f)
+	}
+	for f := range o {
+		union.Add(f)
+	}
+	return union
+}